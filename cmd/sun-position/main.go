@@ -0,0 +1,61 @@
+// sun-position prints the sun's current position and the day's sunrise, sunset, and
+// twilight times for a location
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chrissnell/remoteweather/util/solar"
+)
+
+func main() {
+	lat := flag.Float64("lat", 0, "latitude in degrees, north positive")
+	lon := flag.Float64("lon", 0, "longitude in degrees, east positive")
+	alt := flag.Float64("alt", 0, "height above the surrounding terrain in meters")
+	timeFlag := flag.String("time", "", "time to calculate for, in RFC3339 format (default: now)")
+	flag.Parse()
+
+	t := time.Now()
+	if *timeFlag != "" {
+		var err error
+		t, err = time.Parse(time.RFC3339, *timeFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "invalid -time: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if *lat < -90 || *lat > 90 || *lon < -180 || *lon > 180 {
+		fmt.Fprintln(os.Stderr, "-lat must be between -90 and 90 and -lon between -180 and 180")
+		os.Exit(1)
+	}
+
+	st := solar.SunTimes(*lat, *lon, *alt, t)
+
+	format := func(et time.Time) string {
+		if et.IsZero() {
+			return "does not occur"
+		}
+		return et.Format("15:04:05 MST")
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Time\t%v\n", t.Format(time.RFC3339))
+	fmt.Fprintf(tw, "Elevation\t%.2f°\n", solar.Elevation(*lat, *lon, t))
+	fmt.Fprintf(tw, "Azimuth\t%.2f°\n", solar.Azimuth(*lat, *lon, t))
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "Astronomical dawn\t%v\n", format(st.AstronomicalDawn))
+	fmt.Fprintf(tw, "Nautical dawn\t%v\n", format(st.NauticalDawn))
+	fmt.Fprintf(tw, "Civil dawn\t%v\n", format(st.CivilDawn))
+	fmt.Fprintf(tw, "Sunrise\t%v\n", format(st.Sunrise))
+	fmt.Fprintf(tw, "Solar noon\t%v\n", format(st.SolarNoon))
+	fmt.Fprintf(tw, "Sunset\t%v\n", format(st.Sunset))
+	fmt.Fprintf(tw, "Civil dusk\t%v\n", format(st.CivilDusk))
+	fmt.Fprintf(tw, "Nautical dusk\t%v\n", format(st.NauticalDusk))
+	fmt.Fprintf(tw, "Astronomical dusk\t%v\n", format(st.AstronomicalDusk))
+	tw.Flush()
+}
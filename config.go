@@ -21,6 +21,46 @@ type DeviceConfig struct {
 	Port         string `yaml:"port,omitempty"`
 	SerialDevice string `yaml:"serialdevice,omitempty"`
 	Baud         int    `yaml:"baud,omitempty"`
+	Group        string `yaml:"group,omitempty"`
+	Location     Point  `yaml:"location,omitempty"`
+	// Altitude is the station's elevation in feet
+	Altitude float64 `yaml:"altitude,omitempty"`
+
+	DerivedFields           DerivedFieldsConfig   `yaml:"derived-fields,omitempty"`
+	RainRateFromIncremental bool                  `yaml:"rain-rate-from-incremental,omitempty"`
+	RainRateWindow          string                `yaml:"rain-rate-window,omitempty"`
+	DuplicateTolerance      string                `yaml:"duplicate-tolerance,omitempty"`
+	TimestampSource         string                `yaml:"timestamp-source,omitempty"`
+	StoreFields             []string              `yaml:"store-fields,omitempty"`
+	TimestampRepair         TimestampRepairConfig `yaml:"timestamp-repair,omitempty"`
+	WindInputUnit           string                `yaml:"wind-input-unit,omitempty"`
+	TemperatureInputUnit    string                `yaml:"temperature-input-unit,omitempty"`
+	RateLimit               RateLimitConfig       `yaml:"rate-limit,omitempty"`
+	GustWindow              string                `yaml:"gust-window,omitempty"`
+}
+
+// DerivedFieldsConfig selects which derived values are calculated for a station's
+// readings.  Any value that is not explicitly disabled is calculated.
+type DerivedFieldsConfig struct {
+	WindChill            *bool                `yaml:"wind-chill,omitempty"`
+	HeatIndex            *bool                `yaml:"heat-index,omitempty"`
+	PrecipType           *bool                `yaml:"precip-type,omitempty"`
+	DewPoint             *bool                `yaml:"dew-point,omitempty"`
+	WetBulb              *bool                `yaml:"wet-bulb,omitempty"`
+	AbsoluteHumidity     *bool                `yaml:"absolute-humidity,omitempty"`
+	PrecipTypeThresholds PrecipTypeThresholds `yaml:"precip-type-thresholds,omitempty"`
+	// TemperatureField and HumidityField name the columns that feed the derived
+	// calculations, for stations whose primary outdoor sensor isn't outtemp/outhumidity
+	TemperatureField string `yaml:"temperature-field,omitempty"`
+	HumidityField    string `yaml:"humidity-field,omitempty"`
+}
+
+// PrecipTypeThresholds holds the wet-bulb temperatures (°F) used to infer the type of
+// precipitation that is falling.  At or below SnowMaxWetBulb, precipitation is classified
+// as snow.  At or above RainMinWetBulb, it is classified as rain.  In between, it's a mix.
+type PrecipTypeThresholds struct {
+	SnowMaxWetBulb float32 `yaml:"snow-max-wet-bulb,omitempty"`
+	RainMinWetBulb float32 `yaml:"rain-min-wet-bulb,omitempty"`
 }
 
 // StorageConfig holds the configuration for various storage backends.
@@ -40,6 +80,7 @@ type ControllerConfig struct {
 	PWSWeather         PWSWeatherConfig         `yaml:"pwsweather,omitempty"`
 	WeatherUnderground WeatherUndergroundConfig `yaml:"weatherunderground,omitempty"`
 	AerisWeather       AerisWeatherConfig       `yaml:"aerisweather,omitempty"`
+	EmailReport        EmailReportConfig        `yaml:"emailreport,omitempty"`
 }
 
 // NewConfig creates an new config object from the given filename.
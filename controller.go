@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/url"
 	"sync"
+	"time"
 
 	"go.uber.org/zap"
 )
@@ -51,6 +54,13 @@ func NewControllerManager(ctx context.Context, wg *sync.WaitGroup, c *Config, lo
 				return &ControllerManager{}, fmt.Errorf("error creating new Aeris Weather controller: %v", err)
 			}
 			cm.Controllers = append(cm.Controllers, controller)
+		case "emailreport":
+			log.Info("Creating email report controller...")
+			controller, err := NewEmailReportController(ctx, wg, c, con.EmailReport, logger)
+			if err != nil {
+				return &ControllerManager{}, fmt.Errorf("error creating new email report controller: %v", err)
+			}
+			cm.Controllers = append(cm.Controllers, controller)
 
 		}
 
@@ -69,3 +79,88 @@ func (cm *ControllerManager) StartControllers() error {
 
 	return nil
 }
+
+// validateUploadFields checks that an uploader's include/exclude field lists only name
+// fields that the uploader knows how to send
+func validateUploadFields(known []string, include []string, exclude []string) error {
+	if len(include) > 0 && len(exclude) > 0 {
+		return fmt.Errorf("only one of include-fields or exclude-fields may be set")
+	}
+
+	for _, list := range [][]string{include, exclude} {
+		for _, f := range list {
+			if !stringInSlice(f, known) {
+				return fmt.Errorf("unknown upload field %v (valid fields: %v)", f, known)
+			}
+		}
+	}
+
+	return nil
+}
+
+// filterUploadFields removes the measurements in v that the include/exclude field lists
+// don't allow.  Parameters that aren't measurements, like station ID and password, are
+// always left alone.
+func filterUploadFields(v url.Values, known []string, include []string, exclude []string) {
+	for _, f := range known {
+		if len(include) > 0 && !stringInSlice(f, include) {
+			v.Del(f)
+		}
+		if stringInSlice(f, exclude) {
+			v.Del(f)
+		}
+	}
+}
+
+func stringInSlice(s string, list []string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultHTTPTimeout is used by controllers that don't configure an http-timeout
+const defaultHTTPTimeout = 5 * time.Second
+
+// controllerHTTPTransport is shared by all controllers so that connections to outside
+// services are pooled and reused between requests
+var controllerHTTPTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConns:        10,
+	MaxIdleConnsPerHost: 2,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// userAgentTransport identifies remoteweather to outside services.  Some services
+// rate-limit or block requests that don't carry a proper User-Agent.
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", fmt.Sprintf("remoteweather/%v (+https://github.com/chrissnell/remoteweather)", version))
+	return t.base.RoundTrip(req)
+}
+
+// newHTTPClient creates an HTTP client for a controller to talk to an outside service.
+// timeoutSeconds is the controller's configured http-timeout, if any.
+func newHTTPClient(timeoutSeconds string) (*http.Client, error) {
+	timeout := defaultHTTPTimeout
+
+	if timeoutSeconds != "" {
+		t, err := time.ParseDuration(fmt.Sprintf("%vs", timeoutSeconds))
+		if err != nil {
+			return nil, fmt.Errorf("invalid http-timeout %v: %v", timeoutSeconds, err)
+		}
+		timeout = t
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &userAgentTransport{base: controllerHTTPTransport},
+	}, nil
+}
@@ -24,6 +24,7 @@ type AerisWeatherController struct {
 	AerisWeatherConfig AerisWeatherConfig
 	logger             *zap.SugaredLogger
 	DB                 *TimescaleDBClient
+	client             *http.Client
 }
 
 type AerisWeatherConfig struct {
@@ -31,6 +32,7 @@ type AerisWeatherConfig struct {
 	APIClientSecret string `yaml:"api-client-secret"`
 	APIEndpoint     string `yaml:"api-endpoint,omitempty"`
 	Location        string `yaml:"location"`
+	HTTPTimeout     string `yaml:"http-timeout,omitempty"`
 }
 
 type AerisWeatherForecastResponse struct {
@@ -106,24 +108,33 @@ func NewAerisWeatherController(ctx context.Context, wg *sync.WaitGroup, c *Confi
 		return &AerisWeatherController{}, fmt.Errorf("forecast location must be set")
 	}
 
+	client, err := newHTTPClient(a.AerisWeatherConfig.HTTPTimeout)
+	if err != nil {
+		return &AerisWeatherController{}, err
+	}
+	a.client = client
+
 	a.DB = NewTimescaleDBClient(c, logger)
 
 	// Connect to TimescaleDB for purposes of storing Aeris data for future client requests
-	err := a.DB.connectToTimescaleDB(c.Storage)
+	err = a.DB.connectToTimescaleDB(c.Storage)
 	if err != nil {
 		return &AerisWeatherController{}, fmt.Errorf("could not connect to TimescaleDB: %v", err)
 	}
 
-	err = a.CreateTables()
-	if err != nil {
-		return &AerisWeatherController{}, err
-	}
-
 	return &a, nil
 }
 
 func (a *AerisWeatherController) StartController() error {
 	log.Info("Starting Aeris Weather controller...")
+
+	// The forecast table is created here rather than in NewAerisWeatherController so
+	// that the self-test can build the controller without touching the schema
+	err := a.CreateTables()
+	if err != nil {
+		return err
+	}
+
 	a.wg.Add(1)
 	defer a.wg.Done()
 
@@ -196,10 +207,6 @@ func (a *AerisWeatherController) fetchAndStoreForecast(numPeriods int16, periodH
 	v.Set("filter", fmt.Sprintf("%vh", strconv.FormatInt(int64(periodHours), 10)))
 	v.Set("limit", strconv.FormatInt(int64(numPeriods), 10))
 
-	client := http.Client{
-		Timeout: 5 * time.Second,
-	}
-
 	url := fmt.Sprint(a.AerisWeatherConfig.APIEndpoint + "/forecasts/" + a.AerisWeatherConfig.Location + "?" + v.Encode())
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
@@ -208,7 +215,7 @@ func (a *AerisWeatherController) fetchAndStoreForecast(numPeriods int16, periodH
 
 	log.Debugf("Making request to Aeris Weather: %v", url)
 	req = req.WithContext(a.ctx)
-	resp, err := client.Do(req)
+	resp, err := a.client.Do(req)
 	if err != nil {
 		return &AerisWeatherForecastRecord{}, fmt.Errorf("error making request to Aeris Weather: %v", err)
 	}
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	htmltemplate "html/template"
+	"net"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// EmailReportController sends a periodic summary of a station's weather by email
+type EmailReportController struct {
+	ctx               context.Context
+	wg                *sync.WaitGroup
+	config            *Config
+	EmailReportConfig EmailReportConfig
+	logger            *zap.SugaredLogger
+	DB                *TimescaleDBClient
+	sendAt            time.Duration
+	sendDay           time.Weekday
+	// summarySQL is the weather summary query for this database's weather_1d view
+	summarySQL string
+}
+
+// EmailReportConfig holds configuration for this controller
+type EmailReportConfig struct {
+	PullFromDevice string   `yaml:"pull-from-device,omitempty"`
+	Schedule       string   `yaml:"schedule,omitempty"`
+	SendAt         string   `yaml:"send-at,omitempty"`
+	SendDay        string   `yaml:"send-day,omitempty"`
+	SMTPServer     string   `yaml:"smtp-server,omitempty"`
+	SMTPUsername   string   `yaml:"smtp-username,omitempty"`
+	SMTPPassword   string   `yaml:"smtp-password,omitempty"`
+	From           string   `yaml:"from,omitempty"`
+	To             []string `yaml:"to,omitempty"`
+}
+
+// WeatherSummary holds the summarized weather for a reporting period
+type WeatherSummary struct {
+	StationName string    `gorm:"-"`
+	Start       time.Time `gorm:"-"`
+	End         time.Time `gorm:"-"`
+	HighTemp    float32   `gorm:"column:high_temp"`
+	LowTemp     float32   `gorm:"column:low_temp"`
+	TotalRain   float32   `gorm:"column:total_rain"`
+	PeakGust    float32   `gorm:"column:peak_gust"`
+	AvgWind     float32   `gorm:"column:avg_wind"`
+	Days        int       `gorm:"column:days"`
+}
+
+// weatherSummarySQL summarizes a station's daily aggregates.  The peak gust expression is
+// filled in by weatherSummaryQuery.
+const weatherSummarySQL = `SELECT
+    max(max_outtemp) AS high_temp,
+    min(min_outtemp) AS low_temp,
+    COALESCE(sum(period_rain), 0) AS total_rain,
+    %v AS peak_gust,
+    avg(windspeed) AS avg_wind,
+    count(*) AS days
+FROM weather_1d
+WHERE stationname = ? AND bucket >= ? AND bucket < ?;`
+
+// weatherSummaryQuery returns the summary query for a weather_1d view with or without
+// the max_windgust column.  Views created before that column was added keep working, but
+// report the peak wind speed as the gust.
+func weatherSummaryQuery(hasWindGust bool) string {
+	if !hasWindGust {
+		return fmt.Sprintf(weatherSummarySQL, "max(max_windspeed)")
+	}
+	// Stations that neither report nor derive a gust store zero, so we fall back to their
+	// peak wind speed
+	return fmt.Sprintf(weatherSummarySQL, "COALESCE(NULLIF(max(max_windgust), 0), max(max_windspeed))")
+}
+
+var emailReportTemplate = htmltemplate.Must(htmltemplate.New("report").Parse(`<html>
+<body style="font-family: sans-serif;">
+<h2>Weather report for {{.StationName}}</h2>
+<p>{{.Start.Format "Mon Jan 2, 2006"}}{{if ne (.Start.Format "20060102") (.End.Format "20060102")}} &ndash; {{.End.Format "Mon Jan 2, 2006"}}{{end}}</p>
+<table cellpadding="4">
+<tr><td>High temperature</td><td>{{printf "%.1f" .HighTemp}} &deg;F</td></tr>
+<tr><td>Low temperature</td><td>{{printf "%.1f" .LowTemp}} &deg;F</td></tr>
+<tr><td>Total rain</td><td>{{printf "%.2f" .TotalRain}} in</td></tr>
+<tr><td>Peak gust</td><td>{{printf "%.0f" .PeakGust}} mph</td></tr>
+<tr><td>Average wind</td><td>{{printf "%.1f" .AvgWind}} mph</td></tr>
+</table>
+</body>
+</html>
+`))
+
+func NewEmailReportController(ctx context.Context, wg *sync.WaitGroup, c *Config, e EmailReportConfig, logger *zap.SugaredLogger) (*EmailReportController, error) {
+	erc := EmailReportController{
+		ctx:               ctx,
+		wg:                wg,
+		config:            c,
+		EmailReportConfig: e,
+		logger:            logger,
+	}
+
+	if erc.config.Storage.TimescaleDB.ConnectionString == "" {
+		return &EmailReportController{}, fmt.Errorf("TimescaleDB storage must be configured for the email report controller to function")
+	}
+
+	if erc.EmailReportConfig.PullFromDevice == "" {
+		return &EmailReportController{}, fmt.Errorf("pull-from-device must be set")
+	}
+
+	if erc.EmailReportConfig.SMTPServer == "" {
+		return &EmailReportController{}, fmt.Errorf("smtp-server must be set")
+	}
+
+	if _, _, err := net.SplitHostPort(erc.EmailReportConfig.SMTPServer); err != nil {
+		return &EmailReportController{}, fmt.Errorf("smtp-server must be in host:port form: %v", err)
+	}
+
+	if erc.EmailReportConfig.From == "" {
+		return &EmailReportController{}, fmt.Errorf("from must be set")
+	}
+
+	if len(erc.EmailReportConfig.To) == 0 {
+		return &EmailReportController{}, fmt.Errorf("at least one to address must be set")
+	}
+
+	switch erc.EmailReportConfig.Schedule {
+	case "":
+		erc.EmailReportConfig.Schedule = "daily"
+	case "daily", "weekly":
+	default:
+		return &EmailReportController{}, fmt.Errorf("schedule must be daily or weekly")
+	}
+
+	if erc.EmailReportConfig.SendAt == "" {
+		erc.EmailReportConfig.SendAt = "07:00"
+	}
+
+	sendAt, err := time.Parse("15:04", erc.EmailReportConfig.SendAt)
+	if err != nil {
+		return &EmailReportController{}, fmt.Errorf("send-at must be a time of day like 07:00: %v", err)
+	}
+	erc.sendAt = time.Duration(sendAt.Hour())*time.Hour + time.Duration(sendAt.Minute())*time.Minute
+
+	if erc.EmailReportConfig.SendDay == "" {
+		erc.EmailReportConfig.SendDay = "monday"
+	}
+
+	erc.sendDay, err = parseWeekday(erc.EmailReportConfig.SendDay)
+	if err != nil {
+		return &EmailReportController{}, err
+	}
+
+	erc.DB = NewTimescaleDBClient(c, logger)
+
+	if !erc.DB.validatePullFromStation(erc.EmailReportConfig.PullFromDevice) {
+		return &EmailReportController{}, fmt.Errorf("pull-from-device %v is not a valid station name", erc.EmailReportConfig.PullFromDevice)
+	}
+
+	err = erc.DB.connectToTimescaleDB(c.Storage)
+	if err != nil {
+		return &EmailReportController{}, fmt.Errorf("could not connect to TimescaleDB: %v", err)
+	}
+
+	var found int64
+	err = erc.DB.db.WithContext(ctx).Raw(checkAggregateColumnSQL, "weather_1d", "max_windgust").Scan(&found).Error
+	if err != nil {
+		log.Warnf("could not check weather_1d for the max_windgust column; reporting peak wind speed instead: %v", err)
+	} else if found == 0 {
+		log.Warn("weather_1d lacks the max_windgust column; email reports will show peak wind speed as the gust")
+	}
+	erc.summarySQL = weatherSummaryQuery(err == nil && found > 0)
+
+	return &erc, nil
+}
+
+func (e *EmailReportController) StartController() error {
+	go e.sendScheduledReports()
+	return nil
+}
+
+func (e *EmailReportController) sendScheduledReports() {
+	e.wg.Add(1)
+	defer e.wg.Done()
+
+	for {
+		next := e.nextReportTime(time.Now())
+		log.Infof("next %v email report for %v will be sent at %v", e.EmailReportConfig.Schedule, e.EmailReportConfig.PullFromDevice, next)
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-timer.C:
+			err := e.sendReport(next)
+			if err != nil {
+				log.Errorf("error sending email report: %v", err)
+			}
+		case <-e.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// nextReportTime returns the first scheduled send time after now
+func (e *EmailReportController) nextReportTime(now time.Time) time.Time {
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	next := midnight.Add(e.sendAt)
+
+	for !next.After(now) || (e.EmailReportConfig.Schedule == "weekly" && next.Weekday() != e.sendDay) {
+		midnight = midnight.AddDate(0, 0, 1)
+		next = midnight.Add(e.sendAt)
+	}
+
+	return next
+}
+
+// sendReport summarizes the complete days before sendTime and emails the summary.  The
+// daily aggregate is bucketed by UTC day, so the reporting period is in UTC days, too.
+func (e *EmailReportController) sendReport(sendTime time.Time) error {
+	days := 1
+	if e.EmailReportConfig.Schedule == "weekly" {
+		days = 7
+	}
+
+	end := sendTime.UTC().Truncate(24 * time.Hour)
+	start := end.AddDate(0, 0, -days)
+
+	summary := WeatherSummary{}
+	err := e.DB.db.Raw(e.summarySQL, e.EmailReportConfig.PullFromDevice, start, end).Scan(&summary).Error
+	if err != nil {
+		return fmt.Errorf("error querying database for weather summary: %v", err)
+	}
+
+	if summary.Days == 0 {
+		return fmt.Errorf("no readings for %v between %v and %v", e.EmailReportConfig.PullFromDevice, start, end)
+	}
+
+	summary.StationName = e.EmailReportConfig.PullFromDevice
+	summary.Start = start
+	// The end of the period is exclusive, so we report the last day that's included in it
+	summary.End = end.AddDate(0, 0, -1)
+
+	var body bytes.Buffer
+	err = emailReportTemplate.Execute(&body, summary)
+	if err != nil {
+		return fmt.Errorf("error executing email report template: %v", err)
+	}
+
+	subject := fmt.Sprintf("Weather report for %v: %v", summary.StationName, summary.Start.Format("Jan 2, 2006"))
+	if days > 1 {
+		subject = fmt.Sprintf("Weekly weather report for %v: %v - %v", summary.StationName,
+			summary.Start.Format("Jan 2"), summary.End.Format("Jan 2, 2006"))
+	}
+
+	return e.sendMail(subject, body.Bytes())
+}
+
+func (e *EmailReportController) sendMail(subject string, body []byte) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", e.EmailReportConfig.From)
+	fmt.Fprintf(&msg, "To: %v\r\n", strings.Join(e.EmailReportConfig.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %v\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %v\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.Write(body)
+
+	var auth smtp.Auth
+	if e.EmailReportConfig.SMTPUsername != "" {
+		host, _, _ := net.SplitHostPort(e.EmailReportConfig.SMTPServer)
+		auth = smtp.PlainAuth("", e.EmailReportConfig.SMTPUsername, e.EmailReportConfig.SMTPPassword, host)
+	}
+
+	log.Infof("sending email report to %v", strings.Join(e.EmailReportConfig.To, ", "))
+
+	// smtp.SendMail will upgrade the connection with STARTTLS if the server supports it
+	err := smtp.SendMail(e.EmailReportConfig.SMTPServer, auth, e.EmailReportConfig.From, e.EmailReportConfig.To, msg.Bytes())
+	if err != nil {
+		return fmt.Errorf("error sending mail via %v: %v", e.EmailReportConfig.SMTPServer, err)
+	}
+
+	return nil
+}
+
+func parseWeekday(day string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if strings.EqualFold(d.String(), day) {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("invalid send-day %q", day)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWeatherSummaryQuery(t *testing.T) {
+	withGust := weatherSummaryQuery(true)
+	if !strings.Contains(withGust, "COALESCE(NULLIF(max(max_windgust), 0), max(max_windspeed)) AS peak_gust") {
+		t.Errorf("query for views with max_windgust doesn't report the gust:\n%v", withGust)
+	}
+
+	// Views from before max_windgust was added must not reference it, or every report
+	// fails
+	withoutGust := weatherSummaryQuery(false)
+	if strings.Contains(withoutGust, "max_windgust") {
+		t.Errorf("query for views without max_windgust references it:\n%v", withoutGust)
+	}
+	if !strings.Contains(withoutGust, "max(max_windspeed) AS peak_gust") {
+		t.Errorf("query for views without max_windgust doesn't fall back to the peak wind speed:\n%v", withoutGust)
+	}
+
+	for _, q := range []string{withGust, withoutGust} {
+		if strings.Contains(q, "%!") || strings.Count(q, "?") != 3 {
+			t.Errorf("malformed summary query:\n%v", q)
+		}
+	}
+}
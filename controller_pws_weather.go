@@ -22,17 +22,24 @@ type PWSWeatherController struct {
 	PWSWeatherConfig PWSWeatherConfig
 	logger           *zap.SugaredLogger
 	DB               *TimescaleDBClient
+	client           *http.Client
 }
 
 // PWSWeatherConfig holds configuration for this controller
 type PWSWeatherConfig struct {
-	StationID      string `yaml:"station-id,omitempty"`
-	APIKey         string `yaml:"api-key,omitempty"`
-	APIEndpoint    string `yaml:"api-endpoint,omitempty"`
-	UploadInterval string `yaml:"upload-interval,omitempty"`
-	PullFromDevice string `yaml:"pull-from-device,omitempty"`
+	StationID      string   `yaml:"station-id,omitempty"`
+	APIKey         string   `yaml:"api-key,omitempty"`
+	APIEndpoint    string   `yaml:"api-endpoint,omitempty"`
+	UploadInterval string   `yaml:"upload-interval,omitempty"`
+	PullFromDevice string   `yaml:"pull-from-device,omitempty"`
+	IncludeFields  []string `yaml:"include-fields,omitempty"`
+	ExcludeFields  []string `yaml:"exclude-fields,omitempty"`
+	HTTPTimeout    string   `yaml:"http-timeout,omitempty"`
 }
 
+// pwsWeatherUploadFields are the measurements that we send to PWS Weather
+var pwsWeatherUploadFields = []string{"winddir", "windspeedmph", "windgustmph", "humidity", "tempf", "dailyrainin", "baromin", "solarradiation"}
+
 func NewPWSWeatherController(ctx context.Context, wg *sync.WaitGroup, c *Config, p PWSWeatherConfig, logger *zap.SugaredLogger) (*PWSWeatherController, error) {
 	pwsc := PWSWeatherController{
 		ctx:              ctx,
@@ -58,6 +65,16 @@ func NewPWSWeatherController(ctx context.Context, wg *sync.WaitGroup, c *Config,
 		return &PWSWeatherController{}, fmt.Errorf("pull-from-device must be set")
 	}
 
+	err := validateUploadFields(pwsWeatherUploadFields, pwsc.PWSWeatherConfig.IncludeFields, pwsc.PWSWeatherConfig.ExcludeFields)
+	if err != nil {
+		return &PWSWeatherController{}, err
+	}
+
+	pwsc.client, err = newHTTPClient(pwsc.PWSWeatherConfig.HTTPTimeout)
+	if err != nil {
+		return &PWSWeatherController{}, err
+	}
+
 	if pwsc.PWSWeatherConfig.APIEndpoint == "" {
 		pwsc.PWSWeatherConfig.APIEndpoint = "https://pwsupdate.pwsweather.com/api/v1/submitwx"
 	}
@@ -73,7 +90,7 @@ func NewPWSWeatherController(ctx context.Context, wg *sync.WaitGroup, c *Config,
 		return &PWSWeatherController{}, fmt.Errorf("pull-from-device %v is not a valid station name", pwsc.PWSWeatherConfig.PullFromDevice)
 	}
 
-	err := pwsc.DB.connectToTimescaleDB(c.Storage)
+	err = pwsc.DB.connectToTimescaleDB(c.Storage)
 	if err != nil {
 		return &PWSWeatherController{}, fmt.Errorf("could not connect to TimescaleDB: %v", err)
 	}
@@ -132,7 +149,6 @@ func (p *PWSWeatherController) sendReadingsToPWSWeather(r *FetchedBucketReading)
 	v.Set("dateutc", now.Format("2006-01-02 15:04:05"))
 
 	// Set some values for our weather metrics
-	v.Set("winddir", strconv.FormatInt(int64(r.WindDir), 10))
 	v.Set("windspeedmph", strconv.FormatInt(int64(r.WindSpeed), 10))
 	v.Set("windgustmph", strconv.FormatInt(int64(r.MaxWindSpeed), 10))
 	v.Set("humidity", strconv.FormatInt(int64(r.OutHumidity), 10))
@@ -140,12 +156,15 @@ func (p *PWSWeatherController) sendReadingsToPWSWeather(r *FetchedBucketReading)
 	v.Set("dailyrainin", fmt.Sprintf("%.2f", r.DayRain))
 	v.Set("baromin", fmt.Sprintf("%.2f", r.Barometer))
 	v.Set("solarradiation", fmt.Sprintf("%0.2f", r.SolarWatts))
-	v.Set("softwaretype", fmt.Sprintf("RemoteWeather-%v", version))
 
-	client := http.Client{
-		Timeout: 5 * time.Second,
+	// There's no average direction when the wind came from all around the compass
+	if r.WindDir != nil {
+		v.Set("winddir", strconv.FormatInt(int64(*r.WindDir), 10))
 	}
 
+	filterUploadFields(v, pwsWeatherUploadFields, p.PWSWeatherConfig.IncludeFields, p.PWSWeatherConfig.ExcludeFields)
+	v.Set("softwaretype", fmt.Sprintf("RemoteWeather-%v", version))
+
 	req, err := http.NewRequest("GET", fmt.Sprint(p.PWSWeatherConfig.APIEndpoint+"?"+v.Encode()), nil)
 	if err != nil {
 		return fmt.Errorf("error creating PWS Weather HTTP request: %v", err)
@@ -153,7 +172,7 @@ func (p *PWSWeatherController) sendReadingsToPWSWeather(r *FetchedBucketReading)
 
 	log.Debugf("Making request to PWS weather: %v?%v", p.PWSWeatherConfig.APIEndpoint, v.Encode())
 	req = req.WithContext(p.ctx)
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending report to PWS Weather: %v", err)
 	}
@@ -22,17 +22,24 @@ type WeatherUndergroundController struct {
 	wuconfig WeatherUndergroundConfig
 	logger   *zap.SugaredLogger
 	DB       *TimescaleDBClient
+	client   *http.Client
 }
 
 // WeatherUndergroundconfig holds configuration for this controller
 type WeatherUndergroundConfig struct {
-	StationID      string `yaml:"station-id,omitempty"`
-	APIKey         string `yaml:"api-key,omitempty"`
-	UploadInterval string `yaml:"upload-interval,omitempty"`
-	PullFromDevice string `yaml:"pull-from-device,omitempty"`
-	APIEndpoint    string `yaml:"api-endpoint,omitempty"`
+	StationID      string   `yaml:"station-id,omitempty"`
+	APIKey         string   `yaml:"api-key,omitempty"`
+	UploadInterval string   `yaml:"upload-interval,omitempty"`
+	PullFromDevice string   `yaml:"pull-from-device,omitempty"`
+	APIEndpoint    string   `yaml:"api-endpoint,omitempty"`
+	IncludeFields  []string `yaml:"include-fields,omitempty"`
+	ExcludeFields  []string `yaml:"exclude-fields,omitempty"`
+	HTTPTimeout    string   `yaml:"http-timeout,omitempty"`
 }
 
+// weatherUndergroundUploadFields are the measurements that we send to Weather Underground
+var weatherUndergroundUploadFields = []string{"winddir", "windspeedmph", "humidity", "tempf", "dailyrainin", "baromin"}
+
 func NewWeatherUndergroundController(ctx context.Context, wg *sync.WaitGroup, c *Config, wuconfig WeatherUndergroundConfig, logger *zap.SugaredLogger) (*WeatherUndergroundController, error) {
 	wuc := WeatherUndergroundController{
 		ctx:      ctx,
@@ -58,6 +65,16 @@ func NewWeatherUndergroundController(ctx context.Context, wg *sync.WaitGroup, c
 		return &WeatherUndergroundController{}, fmt.Errorf("pull-from-device must be set")
 	}
 
+	err := validateUploadFields(weatherUndergroundUploadFields, wuc.wuconfig.IncludeFields, wuc.wuconfig.ExcludeFields)
+	if err != nil {
+		return &WeatherUndergroundController{}, err
+	}
+
+	wuc.client, err = newHTTPClient(wuc.wuconfig.HTTPTimeout)
+	if err != nil {
+		return &WeatherUndergroundController{}, err
+	}
+
 	if wuc.wuconfig.APIEndpoint == "" {
 		wuc.wuconfig.APIEndpoint = "https://rtupdate.wunderground.com/weatherstation/updateweatherstation.php"
 	}
@@ -73,7 +90,7 @@ func NewWeatherUndergroundController(ctx context.Context, wg *sync.WaitGroup, c
 		return &WeatherUndergroundController{}, fmt.Errorf("pull-from-device %v is not a valid station name", wuc.wuconfig.PullFromDevice)
 	}
 
-	err := wuc.DB.connectToTimescaleDB(c.Storage)
+	err = wuc.DB.connectToTimescaleDB(c.Storage)
 	if err != nil {
 		return &WeatherUndergroundController{}, fmt.Errorf("could not connect to TimescaleDB: %v", err)
 	}
@@ -133,18 +150,20 @@ func (p *WeatherUndergroundController) sendReadingsToWeatherUnderground(r *Fetch
 	v.Set("rtfreq", "2.5")
 
 	// Set some values for our weather metrics
-	v.Set("winddir", strconv.FormatInt(int64(r.WindDir), 10))
 	v.Set("windspeedmph", strconv.FormatInt(int64(r.WindSpeed), 10))
 	v.Set("humidity", strconv.FormatInt(int64(r.InHumidity), 10))
 	v.Set("tempf", fmt.Sprintf("%.1f", r.OutTemp))
 	v.Set("dailyrainin", fmt.Sprintf("%.2f", r.DayRain))
 	v.Set("baromin", fmt.Sprintf("%.2f", r.Barometer))
-	v.Set("softwaretype", fmt.Sprintf("RemoteWeather %v", version))
 
-	client := http.Client{
-		Timeout: 5 * time.Second,
+	// There's no average direction when the wind came from all around the compass
+	if r.WindDir != nil {
+		v.Set("winddir", strconv.FormatInt(int64(*r.WindDir), 10))
 	}
 
+	filterUploadFields(v, weatherUndergroundUploadFields, p.wuconfig.IncludeFields, p.wuconfig.ExcludeFields)
+	v.Set("softwaretype", fmt.Sprintf("RemoteWeather %v", version))
+
 	req, err := http.NewRequest("GET", fmt.Sprint(p.wuconfig.APIEndpoint+"?"+v.Encode()), nil)
 	if err != nil {
 		return fmt.Errorf("error creating PWS Weather HTTP request: %v", err)
@@ -152,7 +171,7 @@ func (p *WeatherUndergroundController) sendReadingsToWeatherUnderground(r *Fetch
 
 	log.Debugf("Making request to Weather Underground: %v?%v", p.wuconfig.APIEndpoint, v.Encode())
 	req = req.WithContext(p.ctx)
-	resp, err := client.Do(req)
+	resp, err := p.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("error sending report to PWS Weather: %v", err)
 	}
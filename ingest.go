@@ -0,0 +1,377 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// ReadingProcessor applies per-station processing to readings as they arrive from the
+// weather stations, before they are handed to the storage backends.  Unlike the derived
+// fields that the station drivers calculate, this processing can depend on the station's
+// previous readings.  It is only called from the reading distributor goroutine, so it
+// needs no locking.
+type ReadingProcessor struct {
+	devices  map[string]DeviceConfig
+	stations map[string]*stationState
+}
+
+// stationState holds what we remember about a station's recent readings
+type stationState struct {
+	lastTimestamp      time.Time
+	duplicateTolerance time.Duration
+	duplicatesDropped  uint64
+	rainRateWindow     time.Duration
+	rainSamples        []rainSample
+	repairTimestamps   bool
+	maxFuture          time.Duration
+	maxBackward        time.Duration
+	timestampsRepaired uint64
+	rateLimit          float64
+	rateBurst          float64
+	rateTokens         float64
+	rateUpdated        time.Time
+	throttled          uint64
+	throttledRain      float32
+	gustWindow         time.Duration
+	windSamples        []windSample
+	pressureSamples    []pressureSample
+}
+
+// TimestampRepairConfig describes when to replace a station's reading timestamps with
+// server time.  A timestamp more than max-future ahead of the server's clock, or more
+// than max-backward behind the station's previous reading, is assumed to come from a
+// bad clock.  Both are Go durations.
+type TimestampRepairConfig struct {
+	Enabled     bool   `yaml:"enabled,omitempty"`
+	MaxFuture   string `yaml:"max-future,omitempty"`
+	MaxBackward string `yaml:"max-backward,omitempty"`
+}
+
+const (
+	defaultTimestampMaxFuture   = time.Minute
+	defaultTimestampMaxBackward = 5 * time.Minute
+)
+
+// RateLimitConfig caps how many readings per minute we'll accept from a station.  Up to
+// burst readings may arrive back-to-back before the limit kicks in.  Readings over the
+// limit are dropped, but their incremental rain is carried over to the next accepted
+// reading so that rain totals stay correct.
+type RateLimitConfig struct {
+	MaxReadingsPerMinute float64 `yaml:"max-readings-per-minute,omitempty"`
+	Burst                int     `yaml:"burst,omitempty"`
+}
+
+// rainSample is the rain that fell between two consecutive readings from a station
+type rainSample struct {
+	start  time.Time
+	end    time.Time
+	amount float32
+}
+
+// windSample is an instantaneous wind speed reported by a station
+type windSample struct {
+	time  time.Time
+	speed float32
+}
+
+// pressureSample is a barometer reading reported by a station
+type pressureSample struct {
+	time      time.Time
+	barometer float32
+}
+
+const (
+	// pressureTrendPeriod is the period over which we measure the pressure trend
+	pressureTrendPeriod = 3 * time.Hour
+	// pressureTrendTolerance is how much older than pressureTrendPeriod the baseline
+	// reading may be, so that a gap in readings doesn't give us a trend over a longer
+	// period than we claim
+	pressureTrendTolerance = 15 * time.Minute
+)
+
+// defaultRainRateWindow is the period over which we calculate rain rate from incremental
+// rain when the device doesn't configure one
+const defaultRainRateWindow = 15 * time.Minute
+
+// NewReadingProcessor creates a ReadingProcessor for the configured devices
+func NewReadingProcessor(c *Config) (*ReadingProcessor, error) {
+	p := ReadingProcessor{
+		devices:  make(map[string]DeviceConfig),
+		stations: make(map[string]*stationState),
+	}
+
+	for _, d := range c.Devices {
+		// We classify precipitation here, so we need the derived field defaults
+		err := validateDerivedFields(&d.DerivedFields)
+		if err != nil {
+			return &ReadingProcessor{}, fmt.Errorf("invalid derived-fields for device %v: %v", d.Name, err)
+		}
+		p.devices[d.Name] = d
+
+		state := &stationState{rainRateWindow: defaultRainRateWindow}
+		if d.RainRateWindow != "" {
+			window, err := time.ParseDuration(d.RainRateWindow)
+			if err != nil || window <= 0 {
+				return &ReadingProcessor{}, fmt.Errorf("invalid rain-rate-window for device %v: %v", d.Name, d.RainRateWindow)
+			}
+			state.rainRateWindow = window
+		}
+
+		if d.TimestampRepair.Enabled {
+			state.repairTimestamps = true
+			state.maxFuture = defaultTimestampMaxFuture
+			state.maxBackward = defaultTimestampMaxBackward
+
+			if d.TimestampRepair.MaxFuture != "" {
+				maxFuture, err := time.ParseDuration(d.TimestampRepair.MaxFuture)
+				if err != nil {
+					return &ReadingProcessor{}, fmt.Errorf("invalid timestamp-repair max-future for device %v: %v", d.Name, err)
+				}
+				state.maxFuture = maxFuture
+			}
+
+			if d.TimestampRepair.MaxBackward != "" {
+				maxBackward, err := time.ParseDuration(d.TimestampRepair.MaxBackward)
+				if err != nil {
+					return &ReadingProcessor{}, fmt.Errorf("invalid timestamp-repair max-backward for device %v: %v", d.Name, err)
+				}
+				state.maxBackward = maxBackward
+			}
+		}
+
+		if d.GustWindow != "" {
+			window, err := time.ParseDuration(d.GustWindow)
+			if err != nil || window <= 0 {
+				return &ReadingProcessor{}, fmt.Errorf("invalid gust-window for device %v: %v", d.Name, d.GustWindow)
+			}
+			state.gustWindow = window
+		}
+
+		if d.RateLimit.MaxReadingsPerMinute < 0 || d.RateLimit.Burst < 0 {
+			return &ReadingProcessor{}, fmt.Errorf("invalid rate-limit for device %v: values must not be negative", d.Name)
+		}
+
+		if d.RateLimit.MaxReadingsPerMinute > 0 {
+			state.rateLimit = d.RateLimit.MaxReadingsPerMinute / 60
+			state.rateBurst = float64(d.RateLimit.Burst)
+			if state.rateBurst < 1 {
+				state.rateBurst = 1
+			}
+			state.rateTokens = state.rateBurst
+		}
+
+		if d.DuplicateTolerance != "" {
+			tolerance, err := time.ParseDuration(d.DuplicateTolerance)
+			if err != nil {
+				return &ReadingProcessor{}, fmt.Errorf("invalid duplicate-tolerance for device %v: %v", d.Name, err)
+			}
+			state.duplicateTolerance = tolerance
+		}
+		p.stations[d.Name] = state
+	}
+
+	return &p, nil
+}
+
+// ProcessReading applies the configured processing to a reading from one of our stations.
+// It returns false if the reading should be dropped instead of being stored.
+func (p *ReadingProcessor) ProcessReading(r *Reading) bool {
+	d, configured := p.devices[r.StationName]
+
+	state, ok := p.stations[r.StationName]
+	if !ok {
+		state = &stationState{rainRateWindow: defaultRainRateWindow}
+		p.stations[r.StationName] = state
+	}
+
+	if state.repairTimestamps {
+		repairTimestamp(r, state)
+	}
+
+	// A reading that isn't newer than the last one we saw from this station is almost
+	// certainly a resend.  Storing it would churn on the (stationname, time) key and
+	// count its rain twice.
+	if !state.lastTimestamp.IsZero() && !r.Timestamp.After(state.lastTimestamp.Add(state.duplicateTolerance)) {
+		state.duplicatesDropped++
+		log.Warnf("dropping duplicate reading from station %v (timestamp %v, previous %v); %v duplicates dropped so far",
+			r.StationName, r.Timestamp, state.lastTimestamp, state.duplicatesDropped)
+		return false
+	}
+
+	// We track gusts before rate limiting so that the wind speeds of throttled readings
+	// still count toward the gust
+	if state.gustWindow > 0 {
+		calcWindGust(r, state)
+	}
+
+	if state.rateLimit > 0 && !allowReading(r, state) {
+		return false
+	}
+
+	if d.RainRateFromIncremental {
+		calcRainRateFromIncremental(r, state)
+	}
+
+	// Precipitation type is classified after the rain rate is recalculated, so that
+	// stations without a rain rate sensor, and readings between tips of the gauge, are
+	// classified by the rain that's falling
+	if configured && derivedFieldEnabled(d.DerivedFields.PrecipType) {
+		temp, humidity := derivedInputs(r, d.DerivedFields)
+		r.PrecipType = calcPrecipType(r, temp, humidity, d.DerivedFields.PrecipTypeThresholds)
+	}
+
+	calcPressureTrend(r, state)
+
+	state.lastTimestamp = r.Timestamp
+
+	return true
+}
+
+// repairTimestamp replaces a reading's timestamp with the server's time if it's too far in
+// the future or too far behind the station's previous reading.  This keeps a console with
+// a drifting or reset clock from scattering readings across the hypertable.
+func repairTimestamp(r *Reading, state *stationState) {
+	now := time.Now()
+
+	var reason string
+	switch {
+	case r.Timestamp.After(now.Add(state.maxFuture)):
+		reason = "in the future"
+	case !state.lastTimestamp.IsZero() && r.Timestamp.Before(state.lastTimestamp.Add(-state.maxBackward)):
+		reason = "older than the previous reading"
+	default:
+		return
+	}
+
+	state.timestampsRepaired++
+	log.Warnf("repaired timestamp %v from station %v (%v); using server time %v instead (%v timestamps repaired so far)",
+		r.Timestamp, r.StationName, reason, now, state.timestampsRepaired)
+	r.Timestamp = now
+}
+
+// allowReading enforces a station's rate limit with a token bucket that refills at the
+// configured rate, measured by the server's clock.  A throttled reading's incremental rain
+// is held and added to the next reading that we accept.
+func allowReading(r *Reading, state *stationState) bool {
+	now := time.Now()
+
+	if !state.rateUpdated.IsZero() {
+		state.rateTokens += now.Sub(state.rateUpdated).Seconds() * state.rateLimit
+		if state.rateTokens > state.rateBurst {
+			state.rateTokens = state.rateBurst
+		}
+	}
+	state.rateUpdated = now
+
+	if state.rateTokens < 1 {
+		state.throttled++
+		state.throttledRain += r.RainIncremental
+		// Log the first throttled reading and then every hundredth so that a flood of
+		// readings doesn't become a flood of log messages
+		if state.throttled%100 == 1 {
+			log.Warnf("station %v is exceeding its rate limit; %v readings throttled so far", r.StationName, state.throttled)
+		}
+		return false
+	}
+
+	state.rateTokens--
+	r.RainIncremental += state.throttledRain
+	state.throttledRain = 0
+
+	return true
+}
+
+// calcWindGust sets the gust to the highest wind speed reported by the station during its
+// gust window, for stations that don't report a gust of their own.  WMO gusts are the
+// highest 3-second average wind speed, but we only have the instantaneous speeds in the
+// readings that we receive.  A station that reports every few seconds will give a figure
+// close to the WMO gust; one that reports less often will miss short gusts that happened
+// between readings and read low.
+func calcWindGust(r *Reading, state *stationState) {
+	state.windSamples = append(state.windSamples, windSample{time: r.Timestamp, speed: r.WindSpeed})
+
+	// Forget the samples that are older than the window
+	windowStart := r.Timestamp.Add(-state.gustWindow)
+	expired := 0
+	for expired < len(state.windSamples) && state.windSamples[expired].time.Before(windowStart) {
+		expired++
+	}
+	state.windSamples = state.windSamples[expired:]
+
+	var gust float32
+	for _, s := range state.windSamples {
+		if s.speed > gust {
+			gust = s.speed
+		}
+	}
+
+	r.WindGust = gust
+}
+
+// calcPressureTrend sets the reading's pressure trend to the change in barometer since the
+// station's reading from three hours ago.  Readings without a barometer are skipped.
+func calcPressureTrend(r *Reading, state *stationState) {
+	if r.Barometer <= 0 {
+		return
+	}
+
+	// Forget the samples that we no longer need, keeping the newest one that's at least
+	// a full period old to measure against
+	periodStart := r.Timestamp.Add(-pressureTrendPeriod)
+	expired := 0
+	for expired+1 < len(state.pressureSamples) && !state.pressureSamples[expired+1].time.After(periodStart) {
+		expired++
+	}
+	state.pressureSamples = state.pressureSamples[expired:]
+
+	if len(state.pressureSamples) > 0 {
+		baseline := state.pressureSamples[0]
+		if !baseline.time.After(periodStart) && !baseline.time.Before(periodStart.Add(-pressureTrendTolerance)) {
+			trend := r.Barometer - baseline.barometer
+			r.PressureTrend = &trend
+		}
+	}
+
+	state.pressureSamples = append(state.pressureSamples, pressureSample{time: r.Timestamp, barometer: r.Barometer})
+}
+
+// calcRainRateFromIncremental replaces the station-reported rain rate with one calculated
+// from the incremental rain that fell during the station's rain rate window, scaled to
+// inches per hour.  The window is measured by the readings' timestamps rather than by a
+// count of readings, so stations that report every few seconds and stations that report
+// every few minutes get comparable rates.  The first reading from a station is left
+// alone since there's no previous reading to measure against.
+func calcRainRateFromIncremental(r *Reading, state *stationState) {
+	previous := state.lastTimestamp
+	if previous.IsZero() || !r.Timestamp.After(previous) {
+		return
+	}
+
+	// A station whose rain counter resets or wraps around can report a negative
+	// increment.  No rain fell backwards, so it counts as none.
+	amount := r.RainIncremental
+	if amount < 0 {
+		amount = 0
+	}
+
+	state.rainSamples = append(state.rainSamples, rainSample{start: previous, end: r.Timestamp, amount: amount})
+
+	// Forget the samples that ended before the window began
+	windowStart := r.Timestamp.Add(-state.rainRateWindow)
+	expired := 0
+	for expired < len(state.rainSamples) && !state.rainSamples[expired].end.After(windowStart) {
+		expired++
+	}
+	state.rainSamples = state.rainSamples[expired:]
+
+	var total float32
+	for _, s := range state.rainSamples {
+		total += s.amount
+	}
+
+	// The oldest sample may have started before the window did (e.g. after a gap in
+	// readings), so we measure the period actually covered by the samples
+	covered := r.Timestamp.Sub(state.rainSamples[0].start)
+
+	r.RainRate = total / float32(covered.Hours())
+}
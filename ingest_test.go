@@ -0,0 +1,196 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func newTestProcessor(t *testing.T, d DeviceConfig) *ReadingProcessor {
+	t.Helper()
+	d.Name = "test"
+	p, err := NewReadingProcessor(&Config{Devices: []DeviceConfig{d}})
+	if err != nil {
+		t.Fatalf("NewReadingProcessor: %v", err)
+	}
+	return p
+}
+
+func closeTo(a, b float32) bool {
+	return math.Abs(float64(a-b)) < 1e-4
+}
+
+func TestRainRateFromIncremental(t *testing.T) {
+	p := newTestProcessor(t, DeviceConfig{RainRateFromIncremental: true, RainRateWindow: "15m"})
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	readings := []struct {
+		offset      time.Duration
+		incremental float32
+		want        float32
+	}{
+		// The first reading keeps the station's rate since there's nothing to measure against
+		{0, 0, 9.9},
+		{5 * time.Minute, 0.1, 1.2},
+		{10 * time.Minute, 0.1, 1.2},
+		{15 * time.Minute, 0, 0.8},
+		// The first sample has left the window
+		{20 * time.Minute, 0, 0.4},
+		// After a gap, the rate covers the whole gap rather than just the window
+		{80 * time.Minute, 0.5, 0.5},
+	}
+
+	for _, tc := range readings {
+		r := Reading{StationName: "test", Timestamp: start.Add(tc.offset), RainIncremental: tc.incremental, RainRate: 9.9}
+		if !p.ProcessReading(&r) {
+			t.Fatalf("reading at +%v was dropped", tc.offset)
+		}
+		if !closeTo(r.RainRate, tc.want) {
+			t.Errorf("rain rate at +%v = %v, want %v", tc.offset, r.RainRate, tc.want)
+		}
+	}
+}
+
+func TestRainRateCounterReset(t *testing.T) {
+	p := newTestProcessor(t, DeviceConfig{RainRateFromIncremental: true})
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for i, incremental := range []float32{0, 0.1, -12.5, 0.1} {
+		r := Reading{StationName: "test", Timestamp: start.Add(time.Duration(i) * 5 * time.Minute), RainIncremental: incremental}
+		p.ProcessReading(&r)
+		if r.RainRate < 0 {
+			t.Errorf("reading %v: rain rate = %v after a counter reset, want >= 0", i, r.RainRate)
+		}
+	}
+
+	// The reset counts as no rain, so the window holds only the 0.1" that fell after it
+	r := Reading{StationName: "test", Timestamp: start.Add(20 * time.Minute)}
+	p.ProcessReading(&r)
+	if !closeTo(r.RainRate, 0.4) {
+		t.Errorf("rain rate after counter reset = %v, want 0.4", r.RainRate)
+	}
+}
+
+func TestDuplicateReadings(t *testing.T) {
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		tolerance string
+		offset    time.Duration
+		want      bool
+	}{
+		{"same timestamp", "", 0, false},
+		{"older timestamp", "", -time.Second, false},
+		{"newer timestamp", "", time.Second, true},
+		{"within tolerance", "2s", 2 * time.Second, false},
+		{"beyond tolerance", "2s", 3 * time.Second, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestProcessor(t, DeviceConfig{DuplicateTolerance: tc.tolerance})
+
+			first := Reading{StationName: "test", Timestamp: start}
+			if !p.ProcessReading(&first) {
+				t.Fatal("first reading was dropped")
+			}
+
+			r := Reading{StationName: "test", Timestamp: start.Add(tc.offset)}
+			if got := p.ProcessReading(&r); got != tc.want {
+				t.Errorf("ProcessReading() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDuplicateRainNotCounted(t *testing.T) {
+	p := newTestProcessor(t, DeviceConfig{RainRateFromIncremental: true})
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, r := range []Reading{
+		{StationName: "test", Timestamp: start},
+		{StationName: "test", Timestamp: start.Add(5 * time.Minute), RainIncremental: 0.1},
+		// A resend of the previous reading
+		{StationName: "test", Timestamp: start.Add(5 * time.Minute), RainIncremental: 0.1},
+	} {
+		p.ProcessReading(&r)
+	}
+
+	r := Reading{StationName: "test", Timestamp: start.Add(10 * time.Minute)}
+	p.ProcessReading(&r)
+	if !closeTo(r.RainRate, 0.6) {
+		t.Errorf("rain rate = %v, want 0.6", r.RainRate)
+	}
+}
+
+func TestThrottledRainCarriedForward(t *testing.T) {
+	p := newTestProcessor(t, DeviceConfig{RateLimit: RateLimitConfig{MaxReadingsPerMinute: 1, Burst: 1}})
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	first := Reading{StationName: "test", Timestamp: start, RainIncremental: 0.01}
+	if !p.ProcessReading(&first) {
+		t.Fatal("first reading was throttled")
+	}
+
+	for i, incremental := range []float32{0.1, 0.2} {
+		r := Reading{StationName: "test", Timestamp: start.Add(time.Duration(i+1) * time.Second), RainIncremental: incremental}
+		if p.ProcessReading(&r) {
+			t.Fatalf("reading %v was not throttled", i+1)
+		}
+	}
+
+	// Let a minute's worth of tokens accumulate
+	p.stations["test"].rateUpdated = time.Now().Add(-time.Minute)
+
+	r := Reading{StationName: "test", Timestamp: start.Add(time.Minute), RainIncremental: 0.05}
+	if !p.ProcessReading(&r) {
+		t.Fatal("reading was throttled after the bucket refilled")
+	}
+	if !closeTo(r.RainIncremental, 0.35) {
+		t.Errorf("incremental rain = %v, want 0.35 including the throttled readings' rain", r.RainIncremental)
+	}
+
+	next := Reading{StationName: "test", Timestamp: start.Add(2 * time.Minute), RainIncremental: 0.05}
+	p.stations["test"].rateUpdated = time.Now().Add(-time.Minute)
+	p.ProcessReading(&next)
+	if !closeTo(next.RainIncremental, 0.05) {
+		t.Errorf("incremental rain = %v, want 0.05 once the carried rain has been added", next.RainIncremental)
+	}
+}
+
+func TestPrecipTypeFromRecomputedRate(t *testing.T) {
+	p := newTestProcessor(t, DeviceConfig{RainRateFromIncremental: true})
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	readings := []struct {
+		incremental float32
+		want        string
+	}{
+		{0, ""},
+		{0.01, "rain"},
+		// The gauge hasn't tipped again, but rain is still falling within the window
+		{0, "rain"},
+	}
+
+	for i, tc := range readings {
+		// The station has no rain rate sensor
+		r := Reading{StationName: "test", Timestamp: start.Add(time.Duration(i) * time.Minute),
+			OutTemp: 50, OutHumidity: 80, RainIncremental: tc.incremental}
+		p.ProcessReading(&r)
+		if r.PrecipType != tc.want {
+			t.Errorf("reading %v: precip type = %q, want %q", i, r.PrecipType, tc.want)
+		}
+	}
+}
+
+func TestPrecipTypeDisabled(t *testing.T) {
+	disabled := false
+	p := newTestProcessor(t, DeviceConfig{DerivedFields: DerivedFieldsConfig{PrecipType: &disabled}})
+
+	r := Reading{StationName: "test", Timestamp: time.Now(), OutTemp: 50, OutHumidity: 80, RainRate: 0.1}
+	p.ProcessReading(&r)
+	if r.PrecipType != "" {
+		t.Errorf("precip type = %q with precip-type disabled, want none", r.PrecipType)
+	}
+}
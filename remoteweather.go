@@ -27,6 +27,7 @@ func main() {
 
 	cfgFile := flag.String("config", "config.yaml", "Path to config file (default: ./config.yaml)")
 	debug = flag.Bool("debug", false, "Turn on debugging output")
+	selfTest := flag.Bool("selftest", false, "Check the config and connectivity to all stations, storage backends, and controllers, then exit")
 	flag.Parse()
 
 	// Set up our logger
@@ -49,6 +50,13 @@ func main() {
 		log.Fatal("error reading config file.  Did you pass the -config flag?  Run with -h for help.\n", err)
 	}
 
+	if *selfTest {
+		if !runSelfTest(context.Background(), &cfg) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	sigs := make(chan os.Signal, 1)
 	done := make(chan struct{}, 1)
 
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMain(m *testing.M) {
+	zapLogger = zap.NewNop()
+	log = zapLogger.Sugar()
+	os.Exit(m.Run())
+}
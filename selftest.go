@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// The self-test validates the configuration and checks connectivity to every configured
+// station, storage backend, and controller without starting any of them.  It must not
+// write to anything: the controllers' constructors only validate their configuration and
+// connect, and each connection is closed once its checks are done.  It is meant to
+// be run once on a new deployment to confirm that everything is wired correctly before
+// going live.
+
+const selfTestTimeout = 5 * time.Second
+
+// selfTestResult holds the outcome of a single self-test check
+type selfTestResult struct {
+	Component string
+	Check     string
+	Err       error
+}
+
+// selfTestWarning is returned by a check that found something worth mentioning that
+// doesn't mean the deployment is broken
+type selfTestWarning string
+
+func (w selfTestWarning) Error() string {
+	return string(w)
+}
+
+// runSelfTest runs all checks against the config, prints a table of the results, and
+// returns true if every check passed or only warned
+func runSelfTest(ctx context.Context, c *Config) bool {
+	var results []selfTestResult
+
+	check := func(component string, check string, err error) {
+		results = append(results, selfTestResult{Component: component, Check: check, Err: err})
+	}
+
+	for _, d := range c.Devices {
+		component := fmt.Sprintf("device %v", d.Name)
+
+		switch d.Type {
+		case "davis", "campbellscientific":
+			check(component, "device type", nil)
+		default:
+			check(component, "device type", fmt.Errorf("unsupported device type %q", d.Type))
+			continue
+		}
+
+		if d.Type == "davis" && d.Hostname != "" && d.Port == "" {
+			d.Port = defaultDavisPort
+		}
+
+		switch {
+		case d.SerialDevice != "":
+			_, err := os.Stat(d.SerialDevice)
+			check(component, "serial device "+d.SerialDevice, err)
+		case d.Hostname != "" && d.Port != "":
+			addr := net.JoinHostPort(d.Hostname, d.Port)
+			check(component, "connect to "+addr, selfTestDial(ctx, addr))
+		default:
+			check(component, "connection", fmt.Errorf("must define either a serial device or hostname+port"))
+		}
+	}
+
+	if c.Storage.TimescaleDB.ConnectionString != "" {
+		check("storage timescaledb", "connect to database", selfTestTimescaleDB(ctx, c))
+	}
+
+	if c.Storage.InfluxDB.Host != "" {
+		check("storage influxdb", "ping server", selfTestInfluxDB(c))
+	}
+
+	if c.Storage.GRPC.Port != 0 {
+		g := c.Storage.GRPC
+		check("storage grpc", "pull-from-device", selfTestPullFromDevice(c, g.PullFromDevice))
+		if g.Cert != "" && g.Key != "" {
+			_, err := tls.LoadX509KeyPair(g.Cert, g.Key)
+			check("storage grpc", "load TLS keypair", err)
+		}
+		check("storage grpc", fmt.Sprintf("listen on port %v", g.Port), selfTestListen(fmt.Sprintf(":%v", g.Port)))
+	}
+
+	if c.Storage.RESTServer.Port != 0 {
+		rs := c.Storage.RESTServer
+		check("storage rest", "pull-from-device", selfTestPullFromDevice(c, rs.WeatherSiteConfig.PullFromDevice))
+		if rs.Cert != "" && rs.Key != "" {
+			_, err := tls.LoadX509KeyPair(rs.Cert, rs.Key)
+			check("storage rest", "load TLS keypair", err)
+		}
+		listenAddr := rs.ListenAddr
+		if listenAddr == "" {
+			listenAddr = "0.0.0.0"
+		}
+		addr := fmt.Sprintf("%v:%v", listenAddr, rs.Port)
+		check("storage rest", "listen on "+addr, selfTestListen(addr))
+	}
+
+	if c.Storage.APRS.Callsign != "" {
+		a, err := NewAPRSStorage(c)
+		check("storage aprs", "configuration", err)
+		if err == nil {
+			check("storage aprs", "connect to "+a.cfg.Storage.APRS.APRSISServer, selfTestAPRSIS(ctx, a.cfg.Storage.APRS.APRSISServer))
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, con := range c.Controllers {
+		component := fmt.Sprintf("controller %v", con.Type)
+
+		switch con.Type {
+		case "pwsweather":
+			p, err := NewPWSWeatherController(ctx, &wg, c, con.PWSWeather, log)
+			check(component, "configuration and database", err)
+			if err == nil {
+				check(component, "reach "+p.PWSWeatherConfig.APIEndpoint, selfTestHTTP(ctx, p.PWSWeatherConfig.APIEndpoint))
+				p.DB.close()
+			}
+		case "weatherunderground":
+			wu, err := NewWeatherUndergroundController(ctx, &wg, c, con.WeatherUnderground, log)
+			check(component, "configuration and database", err)
+			if err == nil {
+				check(component, "reach "+wu.wuconfig.APIEndpoint, selfTestHTTP(ctx, wu.wuconfig.APIEndpoint))
+				wu.DB.close()
+			}
+		case "aerisweather":
+			a, err := NewAerisWeatherController(ctx, &wg, c, con.AerisWeather, log)
+			check(component, "configuration and database", err)
+			if err == nil {
+				// Fetching a single forecast period exercises the API credentials.  The
+				// forecast is returned to us rather than stored.
+				_, err = a.fetchAndStoreForecast(1, 24)
+				check(component, "authenticate to "+a.AerisWeatherConfig.APIEndpoint, err)
+				a.DB.close()
+			}
+		case "emailreport":
+			e, err := NewEmailReportController(ctx, &wg, c, con.EmailReport, log)
+			check(component, "configuration and database", err)
+			if err == nil {
+				check(component, "connect to "+e.EmailReportConfig.SMTPServer, selfTestDial(ctx, e.EmailReportConfig.SMTPServer))
+				e.DB.close()
+			}
+		default:
+			check(component, "controller type", fmt.Errorf("unsupported controller type %q", con.Type))
+		}
+	}
+
+	passed := true
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "COMPONENT\tCHECK\tRESULT")
+	for _, r := range results {
+		var warning selfTestWarning
+		if errors.As(r.Err, &warning) {
+			fmt.Fprintf(tw, "%v\t%v\tWARN: %v\n", r.Component, r.Check, warning)
+		} else if r.Err != nil {
+			passed = false
+			fmt.Fprintf(tw, "%v\t%v\tFAIL: %v\n", r.Component, r.Check, r.Err)
+		} else {
+			fmt.Fprintf(tw, "%v\t%v\tPASS\n", r.Component, r.Check)
+		}
+	}
+	tw.Flush()
+
+	return passed
+}
+
+// selfTestPullFromDevice verifies that pull-from-device names a configured device
+func selfTestPullFromDevice(c *Config, pullFromDevice string) error {
+	if pullFromDevice == "" {
+		return fmt.Errorf("pull-from-device must be set")
+	}
+
+	for _, d := range c.Devices {
+		if d.Name == pullFromDevice {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("pull-from-device %v is not a valid station name", pullFromDevice)
+}
+
+func selfTestDial(ctx context.Context, addr string) error {
+	d := net.Dialer{Timeout: selfTestTimeout}
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// selfTestListen verifies that we are able to bind to addr.  Since the self-test is often
+// run alongside a live server, a port that's already in use is only a warning.
+func selfTestListen(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if errors.Is(err, syscall.EADDRINUSE) {
+		return selfTestWarning("port in use, server probably running")
+	}
+	if err != nil {
+		return err
+	}
+	return l.Close()
+}
+
+func selfTestTimescaleDB(ctx context.Context, c *Config) error {
+	t := NewTimescaleDBClient(c, log)
+
+	err := t.connectToTimescaleDB(c.Storage)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := t.db.DB()
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, selfTestTimeout)
+	defer cancel()
+
+	return sqlDB.PingContext(ctx)
+}
+
+func selfTestInfluxDB(c *Config) error {
+	i, err := NewInfluxDBStorage(c)
+	if err != nil {
+		return err
+	}
+	defer i.InfluxDBConn.Close()
+
+	_, _, err = i.InfluxDBConn.Ping(selfTestTimeout)
+	return err
+}
+
+// selfTestAPRSIS connects to an APRS-IS server and waits for its greeting
+func selfTestAPRSIS(ctx context.Context, server string) error {
+	d := net.Dialer{Timeout: selfTestTimeout}
+	conn, err := d.DialContext(ctx, "tcp", server)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(selfTestTimeout))
+
+	resp, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("error reading greeting: %v", err)
+	}
+
+	if resp[0] != '#' {
+		return fmt.Errorf("server did not respond with proper greeting: %v", resp)
+	}
+
+	return nil
+}
+
+// selfTestHTTP verifies that an HTTP endpoint is reachable.  Any HTTP response counts as
+// success since we can't submit an observation without publishing it.
+func selfTestHTTP(ctx context.Context, endpoint string) error {
+	client, err := newHTTPClient("")
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
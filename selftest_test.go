@@ -0,0 +1,21 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestSelfTestListenPortInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	err = selfTestListen(l.Addr().String())
+	var warning selfTestWarning
+	if !errors.As(err, &warning) {
+		t.Errorf("selfTestListen on a port in use returned %v, want a warning", err)
+	}
+}
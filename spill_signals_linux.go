@@ -0,0 +1,16 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// spillSignals are the signals that may be configured to trigger a spill of buffered
+// readings to disk.  SIGPWR is what most UPS daemons send when power is failing.
+var spillSignals = map[string]os.Signal{
+	"SIGPWR":  syscall.SIGPWR,
+	"SIGUSR1": syscall.SIGUSR1,
+	"SIGUSR2": syscall.SIGUSR2,
+}
+
+const defaultSpillSignal = "SIGPWR"
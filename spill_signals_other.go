@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import "os"
+
+// spillSignals are the signals that may be configured to trigger a spill of buffered
+// readings to disk.  SIGPWR only exists on Linux, so elsewhere readings are only spilled
+// at shutdown.
+var spillSignals = map[string]os.Signal{}
+
+const defaultSpillSignal = ""
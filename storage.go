@@ -3,22 +3,40 @@ package main
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 )
 
 // StorageManager holds our active storage backends
 type StorageManager struct {
-	Engines            []StorageEngine
+	Engines            []*StorageEngine
 	ReadingDistributor chan Reading
+	ReadingProcessor   *ReadingProcessor
+	// dropped counts the readings that each engine missed because its queue was full.
+	// It is only touched by the reading distributor.
+	dropped map[string]uint64
+	// distributorDone is closed once the reading distributor has stopped adding readings
+	// to the engines' queues
+	distributorDone chan struct{}
 }
 
 // StorageEngine holds a backend storage engine's interface as well as
 // a channel for passing readings to the engine
 type StorageEngine struct {
+	Name   string
 	Engine StorageEngineInterface
 	C      chan<- Reading
+	queue  chan Reading
 }
 
+// storageEngineQueueSize is the number of readings that may be waiting for a storage engine
+// before we start dropping readings for that engine
+const storageEngineQueueSize = 100
+
+// storageStatsInterval is how often we log each storage engine's queue depth and drops
+const storageStatsInterval = 15 * time.Minute
+
 // StorageEngineInterface is an interface that provides a few standardized
 // methods for various storage backends
 type StorageEngineInterface interface {
@@ -30,14 +48,19 @@ type StorageEngineInterface interface {
 func NewStorageManager(ctx context.Context, wg *sync.WaitGroup, c *Config) (*StorageManager, error) {
 	var err error
 
-	s := StorageManager{}
+	s := StorageManager{
+		dropped:         make(map[string]uint64),
+		distributorDone: make(chan struct{}),
+	}
 
 	// Initialize our channel for passing metrics to the reading distributor
 	s.ReadingDistributor = make(chan Reading, 20)
 
-	// Start our reading distributor to distribute received readings to storage
-	// backends
-	go s.startReadingDistributor(ctx, wg)
+	// Set up the per-station processing that readings go through before distribution
+	s.ReadingProcessor, err = NewReadingProcessor(c)
+	if err != nil {
+		return &s, err
+	}
 
 	// Check the configuration file for various supported storage backends
 	// and enable them if found
@@ -77,6 +100,11 @@ func NewStorageManager(ctx context.Context, wg *sync.WaitGroup, c *Config) (*Sto
 		}
 	}
 
+	// Start our reading distributor to distribute received readings to storage
+	// backends.  It reads s.Engines without locking, so it mustn't start until every
+	// engine has been added.
+	go s.startReadingDistributor(ctx, wg)
+
 	return &s, nil
 }
 
@@ -84,69 +112,137 @@ func NewStorageManager(ctx context.Context, wg *sync.WaitGroup, c *Config) (*Sto
 func (s *StorageManager) AddEngine(ctx context.Context, wg *sync.WaitGroup, engineName string, c *Config) error {
 	var err error
 
+	// Give the new engine its own queue so that a slow engine can't hold up the others
+	se := &StorageEngine{
+		Name:  engineName,
+		queue: make(chan Reading, storageEngineQueueSize),
+	}
+
 	switch engineName {
 	case "timescaledb":
-		se := StorageEngine{}
-		se.Engine, err = NewTimescaleDBStorage(ctx, c)
+		var t *TimescaleDBStorage
+		t, err = NewTimescaleDBStorage(ctx, c)
 		if err != nil {
 			return err
 		}
-		se.C = se.Engine.StartStorageEngine(ctx, wg)
-		s.Engines = append(s.Engines, se)
+		se.Engine = t
+		// TimescaleDB reads straight from its queue so that it can spill whatever is
+		// left in it when we shut down or lose power
+		t.startFromQueue(ctx, wg, se.queue, s.distributorDone)
 	case "influxdb":
-		se := StorageEngine{}
 		se.Engine, err = NewInfluxDBStorage(c)
 		if err != nil {
 			return err
 		}
 		se.C = se.Engine.StartStorageEngine(ctx, wg)
-		s.Engines = append(s.Engines, se)
-
 	case "grpc":
-		se := StorageEngine{}
 		se.Engine, err = NewGRPCStorage(ctx, c)
 		if err != nil {
 			return err
 		}
 		se.C = se.Engine.StartStorageEngine(ctx, wg)
-		s.Engines = append(s.Engines, se)
-
 	case "rest":
-		se := StorageEngine{}
 		se.Engine, err = NewRESTServerStorage(ctx, c)
 		if err != nil {
 			return err
 		}
 		se.C = se.Engine.StartStorageEngine(ctx, wg)
-		s.Engines = append(s.Engines, se)
 	case "aprs":
-		se := StorageEngine{}
 		se.Engine, err = NewAPRSStorage(c)
 		if err != nil {
 			return err
 		}
 		se.C = se.Engine.StartStorageEngine(ctx, wg)
-		s.Engines = append(s.Engines, se)
+	default:
+		return fmt.Errorf("unknown storage engine %v", engineName)
+	}
+
+	if se.C != nil {
+		go se.forwardReadings(ctx, wg)
 	}
+	s.Engines = append(s.Engines, se)
 
 	return nil
 }
 
+// forwardReadings passes readings from the engine's queue to the engine.  It may block
+// on a slow engine, but only this engine's queue backs up while it does.
+func (se *StorageEngine) forwardReadings(ctx context.Context, wg *sync.WaitGroup) {
+	wg.Add(1)
+	defer wg.Done()
+
+	for {
+		select {
+		case r := <-se.queue:
+			select {
+			case se.C <- r:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 // startReadingDistributor receives readings from gatherers and fans them out to the various
 // storage backends
 func (s *StorageManager) startReadingDistributor(ctx context.Context, wg *sync.WaitGroup) error {
 	wg.Add(1)
 	defer wg.Done()
+	defer close(s.distributorDone)
+
+	ticker := time.NewTicker(storageStatsInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case r := <-s.ReadingDistributor:
-			for _, e := range s.Engines {
-				e.C <- r
-			}
+			s.distributeReading(r)
+		case <-ticker.C:
+			s.logEngineStats()
 		case <-ctx.Done():
-			log.Info("cancellation request received.  Cancelling reading distributor.")
-			return nil
+			// Pass on what the gatherers have already sent so that engines that save their
+			// queue on shutdown can save these readings too
+			for {
+				select {
+				case r := <-s.ReadingDistributor:
+					s.distributeReading(r)
+				default:
+					log.Info("cancellation request received.  Cancelling reading distributor.")
+					return nil
+				}
+			}
 		}
 	}
 }
+
+// distributeReading processes a reading and adds it to each engine's queue
+func (s *StorageManager) distributeReading(r Reading) {
+	if !s.ReadingProcessor.ProcessReading(&r) {
+		return
+	}
+	for _, e := range s.Engines {
+		select {
+		case e.queue <- r:
+		default:
+			s.dropped[e.Name]++
+			// Log the first dropped reading and then every hundredth so that a stalled
+			// engine doesn't flood the log
+			if s.dropped[e.Name]%100 == 1 {
+				log.Warnf("%v storage engine queue is full (%v readings); dropping reading from %v (%v dropped so far)",
+					e.Name, len(e.queue), r.StationName, s.dropped[e.Name])
+			}
+		}
+	}
+}
+
+// logEngineStats logs how many readings are waiting in each engine's queue and how many
+// each engine has dropped since we started
+func (s *StorageManager) logEngineStats() {
+	stats := make([]string, len(s.Engines))
+	for i, e := range s.Engines {
+		stats[i] = fmt.Sprintf("%v %v/%v queued, %v dropped", e.Name, len(e.queue), cap(e.queue), s.dropped[e.Name])
+	}
+	log.Infof("storage engine queues: %v", strings.Join(stats, "; "))
+}
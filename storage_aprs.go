@@ -16,10 +16,11 @@ import (
 // APRSConfig describes the YAML-provided configuration for the APRS storage
 // backend
 type APRSConfig struct {
-	Callsign     string `yaml:"callsign,omitempty"`
-	Passcode     string `yaml:"passcode,omitempty"`
-	APRSISServer string `yaml:"aprs-is-server,omitempty"`
-	Location     Point  `yaml:"location,omitempty"`
+	Callsign     string              `yaml:"callsign,omitempty"`
+	Passcode     string              `yaml:"passcode,omitempty"`
+	APRSISServer string              `yaml:"aprs-is-server,omitempty"`
+	Location     Point               `yaml:"location,omitempty"`
+	PacketLog    APRSPacketLogConfig `yaml:"packet-log,omitempty"`
 }
 
 // CurrentReading is a Reading + a mutex that maintains the most recent reading from
@@ -35,6 +36,7 @@ type APRSStorage struct {
 	cfg             *Config
 	APRSReadingChan chan Reading
 	currentReading  *CurrentReading
+	packetLog       *aprsPacketLog
 }
 
 // Point represents a geographic location of an APRS/CWOP station
@@ -63,6 +65,14 @@ func NewAPRSStorage(c *Config) (APRSStorage, error) {
 		c.Storage.APRS.APRSISServer = "noam.aprs2.net:14580"
 	}
 
+	if c.Storage.APRS.PacketLog.Path != "" {
+		packetLog, err := newAPRSPacketLog(c.Storage.APRS.PacketLog)
+		if err != nil {
+			return a, err
+		}
+		a.packetLog = packetLog
+	}
+
 	a.cfg = c
 
 	a.APRSReadingChan = make(chan Reading, 10)
@@ -179,7 +189,35 @@ func (a *APRSStorage) sendReadingToAPRSIS(ctx context.Context, wg *sync.WaitGrou
 		return
 	}
 
-	conn.Write([]byte(pkt + "\r\n"))
+	_, err = conn.Write([]byte(pkt + "\r\n"))
+	if err != nil {
+		log.Error("error sending packet to APRS-IS server:", err)
+	}
+
+	a.logPacket(pkt, resp, err)
+}
+
+// logPacket records a packet that we sent to APRS-IS, along with the server's response
+// to our login, in the packet log
+func (a *APRSStorage) logPacket(pkt string, resp string, sendErr error) {
+	if a.packetLog == nil {
+		return
+	}
+
+	e := APRSPacketLogEntry{
+		Time:     time.Now(),
+		Server:   a.cfg.Storage.APRS.APRSISServer,
+		Packet:   pkt,
+		Response: strings.TrimSpace(resp),
+	}
+	if sendErr != nil {
+		e.Error = sendErr.Error()
+	}
+
+	err := a.packetLog.Write(e)
+	if err != nil {
+		log.Error("error writing to APRS packet log:", err)
+	}
 }
 
 func (a *APRSStorage) processMetrics(ctx context.Context, wg *sync.WaitGroup, rchan <-chan Reading) {
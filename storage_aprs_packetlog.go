@@ -0,0 +1,193 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// APRSPacketLogConfig describes the YAML-provided configuration for the log of packets
+// that we've sent to APRS-IS.  The log is rotated when it reaches max-size-mb or when it
+// is older than max-age, and the rotated files are gzip-compressed.  Only the newest
+// max-files compressed files are kept.
+type APRSPacketLogConfig struct {
+	Path      string `yaml:"path,omitempty"`
+	MaxSizeMB int    `yaml:"max-size-mb,omitempty"`
+	MaxAge    string `yaml:"max-age,omitempty"`
+	MaxFiles  int    `yaml:"max-files,omitempty"`
+}
+
+// APRSPacketLogEntry is a single line in the packet log
+type APRSPacketLogEntry struct {
+	Time     time.Time `json:"time"`
+	Server   string    `json:"server"`
+	Packet   string    `json:"packet"`
+	Response string    `json:"response,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// aprsPacketLog writes APRSPacketLogEntries to a rotating log file.  Reports are sent
+// from their own goroutines, so writes are serialized with a mutex.
+type aprsPacketLog struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+}
+
+// newAPRSPacketLog validates the packet log config and fills in defaults.  The log file
+// isn't opened until the first packet is written.
+func newAPRSPacketLog(c APRSPacketLogConfig) (*aprsPacketLog, error) {
+	l := aprsPacketLog{
+		path:     c.Path,
+		maxSize:  int64(c.MaxSizeMB) * 1024 * 1024,
+		maxFiles: c.MaxFiles,
+	}
+
+	if l.maxSize == 0 {
+		l.maxSize = 10 * 1024 * 1024
+	}
+
+	if l.maxFiles == 0 {
+		l.maxFiles = 10
+	}
+
+	if c.MaxAge != "" {
+		maxAge, err := time.ParseDuration(c.MaxAge)
+		if err != nil {
+			return nil, fmt.Errorf("invalid packet-log max-age %v: %v", c.MaxAge, err)
+		}
+		l.maxAge = maxAge
+	}
+
+	return &l, nil
+}
+
+// Write appends an entry to the log, rotating the log first if needed
+func (l *aprsPacketLog) Write(e APRSPacketLogEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if l.file != nil && (l.size+int64(len(line)) > l.maxSize || (l.maxAge > 0 && time.Since(l.openedAt) > l.maxAge)) {
+		err = l.rotate()
+		if err != nil {
+			return fmt.Errorf("error rotating APRS packet log: %v", err)
+		}
+	}
+
+	if l.file == nil {
+		err = l.open()
+		if err != nil {
+			return fmt.Errorf("error opening APRS packet log: %v", err)
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	return err
+}
+
+func (l *aprsPacketLog) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = fi.Size()
+	l.openedAt = time.Now()
+
+	return nil
+}
+
+// rotate closes the current log, compresses it, and removes the oldest compressed logs
+// beyond maxFiles
+func (l *aprsPacketLog) rotate() error {
+	err := l.file.Close()
+	l.file = nil
+	if err != nil {
+		return err
+	}
+
+	rotated := fmt.Sprintf("%v.%v", l.path, time.Now().Format("20060102-150405"))
+	err = os.Rename(l.path, rotated)
+	if err != nil {
+		return err
+	}
+
+	err = gzipFile(rotated)
+	if err != nil {
+		return err
+	}
+
+	old, err := filepath.Glob(l.path + ".*.gz")
+	if err != nil {
+		return err
+	}
+
+	// Our timestamp suffix sorts chronologically
+	sort.Strings(old)
+	for len(old) > l.maxFiles {
+		err = os.Remove(old[0])
+		if err != nil {
+			return err
+		}
+		old = old[1:]
+	}
+
+	return nil
+}
+
+// gzipFile compresses path to path.gz and removes the original
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	gz.Name = filepath.Base(path)
+
+	_, err = io.Copy(gz, in)
+	if err == nil {
+		err = gz.Close()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+
+	return os.Remove(path)
+}
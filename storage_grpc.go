@@ -12,6 +12,7 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/reflection"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -23,11 +24,30 @@ import (
 // GRPCConfig describes the YAML-provided configuration for a gRPC
 // storage backend
 type GRPCConfig struct {
-	Cert           string `yaml:"cert,omitempty"`
-	Key            string `yaml:"key,omitempty"`
-	ListenAddr     string `yaml:"listen-addr,omitempty"`
-	Port           int    `yaml:"port,omitempty"`
-	PullFromDevice string `yaml:"pull-from-device,omitempty"`
+	Cert           string              `yaml:"cert,omitempty"`
+	Key            string              `yaml:"key,omitempty"`
+	ListenAddr     string              `yaml:"listen-addr,omitempty"`
+	Port           int                 `yaml:"port,omitempty"`
+	PullFromDevice string              `yaml:"pull-from-device,omitempty"`
+	Keepalive      GRPCKeepaliveConfig `yaml:"keepalive,omitempty"`
+}
+
+// GRPCKeepaliveConfig describes how the gRPC server keeps long-lived client streams
+// healthy.  Durations are Go durations (e.g. "30s").  Connections that sit behind NAT or
+// a firewall can silently go dead; pinging them lets us notice and clean them up, and a
+// max-connection-age forces clients to reconnect periodically.
+type GRPCKeepaliveConfig struct {
+	// Time is how long a connection may be idle before the server pings the client
+	Time string `yaml:"time,omitempty"`
+	// Timeout is how long the server waits for a ping reply before closing the connection
+	Timeout string `yaml:"timeout,omitempty"`
+	// MaxConnectionAge is how long a connection may live before the server asks the
+	// client to reconnect
+	MaxConnectionAge string `yaml:"max-connection-age,omitempty"`
+	// MinClientPingInterval is the most often that clients are allowed to ping us
+	MinClientPingInterval string `yaml:"min-client-ping-interval,omitempty"`
+	// PermitWithoutStream allows clients to ping even when they have no active streams
+	PermitWithoutStream bool `yaml:"permit-without-stream,omitempty"`
 }
 
 // GRPCStorage implements a gRPC storage backend
@@ -78,17 +98,25 @@ func NewGRPCStorage(ctx context.Context, c *Config) (*GRPCStorage, error) {
 	var err error
 	var g GRPCStorage
 
+	var opts []grpc.ServerOption
+
 	if c.Storage.GRPC.Cert != "" && c.Storage.GRPC.Key != "" {
 		// Create the TLS credentials
 		creds, err := credentials.NewServerTLSFromFile(c.Storage.GRPC.Cert, c.Storage.GRPC.Key)
 		if err != nil {
 			return &GRPCStorage{}, fmt.Errorf("could not create TLS server from keypair: %v", err)
 		}
-		g.Server = grpc.NewServer(grpc.Creds(creds))
-	} else {
-		g.Server = grpc.NewServer()
+		opts = append(opts, grpc.Creds(creds))
 	}
 
+	keepaliveOpts, err := grpcKeepaliveOptions(c.Storage.GRPC.Keepalive)
+	if err != nil {
+		return &GRPCStorage{}, err
+	}
+	opts = append(opts, keepaliveOpts...)
+
+	g.Server = grpc.NewServer(opts...)
+
 	if c.Storage.GRPC.PullFromDevice == "" {
 		return &GRPCStorage{}, errors.New("you must configure a pull-from-device to specify the default station to pull data for")
 	}
@@ -190,13 +218,20 @@ func (g *GRPCStorage) transformReadings(dbReadings *[]BucketReading) []*weather.
 	grpcReadings := make([]*weather.WeatherReading, 0)
 
 	for _, r := range *dbReadings {
+		// The protobuf has no way to say that there's no average direction, so a NULL
+		// direction is sent as zero
+		var windDir int32
+		if r.WindDir != nil {
+			windDir = int32(*r.WindDir)
+		}
+
 		grpcReadings = append(grpcReadings, &weather.WeatherReading{
 			ReadingTimestamp:   (*timestamppb.Timestamp)(timestamppb.New(r.Bucket)),
 			OutsideTemperature: r.OutTemp,
 			OutsideHumidity:    int32(r.OutHumidity),
 			Barometer:          r.Barometer,
 			WindSpeed:          int32(r.WindSpeed),
-			WindDirection:      int32(r.WindDir),
+			WindDirection:      windDir,
 			RainfallDay:        r.DayRain,
 			WindChill:          r.WindChill,
 			HeatIndex:          r.HeatIndex,
@@ -244,6 +279,8 @@ func (g *GRPCStorage) GetLiveWeather(req *weather.LiveWeatherRequest, stream wea
 					WindSpeed:          int32(r.WindSpeed),
 					WindDirection:      int32(r.WindDir),
 					RainfallDay:        r.DayRain,
+					WindChill:          r.WindChill,
+					HeatIndex:          r.HeatIndex,
 					StationName:        r.StationName,
 				})
 			}
@@ -251,3 +288,56 @@ func (g *GRPCStorage) GetLiveWeather(req *weather.LiveWeatherRequest, stream wea
 		}
 	}
 }
+
+// grpcKeepaliveOptions builds the server options for our keepalive config.  Anything left
+// unset keeps gRPC's default.
+func grpcKeepaliveOptions(k GRPCKeepaliveConfig) ([]grpc.ServerOption, error) {
+	var opts []grpc.ServerOption
+
+	parse := func(name, value string) (time.Duration, error) {
+		if value == "" {
+			return 0, nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return 0, fmt.Errorf("invalid gRPC keepalive %v %v: %v", name, value, err)
+		}
+		return d, nil
+	}
+
+	params := keepalive.ServerParameters{}
+	var err error
+
+	params.Time, err = parse("time", k.Time)
+	if err != nil {
+		return nil, err
+	}
+
+	params.Timeout, err = parse("timeout", k.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	params.MaxConnectionAge, err = parse("max-connection-age", k.MaxConnectionAge)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Time != 0 || params.Timeout != 0 || params.MaxConnectionAge != 0 {
+		opts = append(opts, grpc.KeepaliveParams(params))
+	}
+
+	minPing, err := parse("min-client-ping-interval", k.MinClientPingInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	if minPing != 0 || k.PermitWithoutStream {
+		opts = append(opts, grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             minPing,
+			PermitWithoutStream: k.PermitWithoutStream,
+		}))
+	}
+
+	return opts, nil
+}
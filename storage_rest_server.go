@@ -7,8 +7,12 @@ import (
 	"fmt"
 	htmltemplate "html/template"
 	"io/fs"
+	"math"
 	"net/http"
 	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"text/template"
 	"time"
@@ -48,6 +52,8 @@ type RESTServerStorage struct {
 	WeatherSiteConfig   *WeatherSiteConfig
 	Devices             []DeviceConfig
 	AerisWeatherEnabled bool
+	rollingRainCache    map[string]*RollingRain
+	rollingRainCacheMu  sync.Mutex
 }
 
 type WeatherReading struct {
@@ -82,6 +88,8 @@ type WeatherReading struct {
 	OutsideHumidity       json.Number `json:"ohum,omitempty"`
 	RainRate              json.Number `json:"rainrate,omitempty"`
 	RainIncremental       json.Number `json:"rainincremental,omitempty"`
+	PeriodRain            json.Number `json:"periodrain,omitempty"`
+	MaxRainRate           json.Number `json:"maxrainrate,omitempty"`
 	SolarWatts            json.Number `json:"solarwatts,omitempty"`
 	SolarJoules           json.Number `json:"solarjoules,omitempty"`
 	UV                    json.Number `json:"uv,omitempty"`
@@ -92,15 +100,63 @@ type WeatherReading struct {
 	YearRain              json.Number `json:"yearrain,omitempty"`
 	Barometer             json.Number `json:"bar,omitempty"`
 	WindSpeed             json.Number `json:"winds,omitempty"`
+	MaxWindSpeed          json.Number `json:"maxwinds,omitempty"`
+	MaxWindGust           json.Number `json:"maxwindgust,omitempty"`
 	WindDirection         json.Number `json:"windd,omitempty"`
+	WindDirectionWeighted json.Number `json:"winddweighted,omitempty"`
 	CardinalDirection     string      `json:"windcard,omitempty"`
 	RainfallDay           json.Number `json:"rainday,omitempty"`
 	WindChill             json.Number `json:"windch,omitempty"`
 	HeatIndex             json.Number `json:"heatidx,omitempty"`
+	DewPoint              json.Number `json:"dewpoint,omitempty"`
+	WetBulb               json.Number `json:"wetbulb,omitempty"`
+	AbsoluteHumidity      json.Number `json:"abshum,omitempty"`
 	InsideTemperature     json.Number `json:"itemp,omitempty"`
 	InsideHumidity        json.Number `json:"ihum,omitempty"`
 	ConsBatteryVoltage    json.Number `json:"consbatteryvoltage,omitempty"`
 	StationBatteryVoltage json.Number `json:"stationbatteryvoltage,omitempty"`
+	PrecipType            string      `json:"preciptype,omitempty"`
+	// PressureTendency is a pointer because 0 is a valid WMO tendency code
+	PressureTendency *int   `json:"bartendency,omitempty"`
+	PressureArrow    string `json:"bararrow,omitempty"`
+	// PressureTrend is the change in barometer over the last three hours
+	PressureTrend      json.Number `json:"bartrend,omitempty"`
+	PressureTrendLabel string      `json:"bartrendlabel,omitempty"`
+	// Gap marks a placeholder for a bucket with no data, inserted when the client asks
+	// for gaps to be filled
+	Gap bool `json:"gap,omitempty"`
+}
+
+// RollingRain holds rain totals over rolling windows ending at the time it was computed.
+// Unlike dayrain, these are not reset at midnight.
+type RollingRain struct {
+	StationName string      `json:"stationname"`
+	Timestamp   int64       `json:"ts"`
+	LastHour    json.Number `json:"rainlasthour"`
+	Last24Hours json.Number `json:"rainlast24h"`
+}
+
+// rollingRainCacheTTL is how long we'll serve a rolling rain total before recomputing it
+const rollingRainCacheTTL = 30 * time.Second
+
+// StationMetadata describes a station in detail for the /station endpoint
+type StationMetadata struct {
+	Name          string   `json:"name"`
+	DisplayName   string   `json:"displayname"`
+	Description   string   `json:"description,omitempty"`
+	Type          string   `json:"type"`
+	Group         string   `json:"group,omitempty"`
+	Latitude      float64  `json:"latitude,omitempty"`
+	Longitude     float64  `json:"longitude,omitempty"`
+	Altitude      float64  `json:"altitude,omitempty"`
+	DerivedFields []string `json:"derivedfields"`
+}
+
+// StationInfo describes one of our stations for the /stations endpoint
+type StationInfo struct {
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Group string `json:"group,omitempty"`
 }
 
 const (
@@ -120,6 +176,7 @@ func NewRESTServerStorage(ctx context.Context, c *Config) (*RESTServerStorage, e
 	r := new(RESTServerStorage)
 
 	r.Devices = c.Devices
+	r.rollingRainCache = make(map[string]*RollingRain)
 
 	// Look to see if the Aeris Weather controller has been configured.
 	// If we've configured it, we will enable the /forecast endpoint later on.
@@ -135,9 +192,9 @@ func NewRESTServerStorage(ctx context.Context, c *Config) (*RESTServerStorage, e
 		c.Storage.RESTServer.ListenAddr = "0.0.0.0"
 	}
 
-	if c.Storage.RESTServer.WeatherSiteConfig.StationName != "" {
-		r.WeatherSiteConfig = &c.Storage.RESTServer.WeatherSiteConfig
-	}
+	// The handlers rely on the weather site config for pull-from-device, so we always keep
+	// a reference to it, even when no station-name was configured
+	r.WeatherSiteConfig = &c.Storage.RESTServer.WeatherSiteConfig
 
 	if c.Storage.RESTServer.WeatherSiteConfig.PullFromDevice == "" {
 		return &RESTServerStorage{}, fmt.Errorf("pull-from-device must be set")
@@ -153,6 +210,11 @@ func NewRESTServerStorage(ctx context.Context, c *Config) (*RESTServerStorage, e
 	router := mux.NewRouter()
 	router.HandleFunc("/span/{span}", r.getWeatherSpan)
 	router.HandleFunc("/latest", r.getWeatherLatest)
+	router.HandleFunc("/rain", r.getRollingRain)
+	router.HandleFunc("/windrose", r.getWindRose)
+	router.HandleFunc("/station", r.getStation)
+	router.HandleFunc("/stations", r.getStations)
+	router.HandleFunc("/groups", r.getGroups)
 	// We only enable the /forecast endpoint if Aeris Weather has been configured.
 	if r.AerisWeatherEnabled {
 		router.HandleFunc("/forecast/{span}", r.getForecast)
@@ -273,6 +335,10 @@ func (r *RESTServerStorage) getWeatherSpan(w http.ResponseWriter, req *http.Requ
 		var dbFetchedReadings []BucketReading
 
 		stationName := req.URL.Query().Get("station")
+		if stationName == "" {
+			// Client did not supply a station name, so pull from the configurated PullFromDevice
+			stationName = r.WeatherSiteConfig.PullFromDevice
+		}
 
 		vars := mux.Vars(req)
 		span, err := time.ParseDuration(vars["span"])
@@ -284,40 +350,51 @@ func (r *RESTServerStorage) getWeatherSpan(w http.ResponseWriter, req *http.Requ
 
 		spanStart := time.Now().Add(-span)
 
-		switch {
-		case span < 1*Day:
-			if stationName != "" {
-				r.DB.Table("weather_1m").Where("bucket > ?", spanStart).Where("stationname = ?", stationName).Order("bucket").Find(&dbFetchedReadings)
-			} else {
-				r.DB.Table("weather_1m").Where("bucket > ?", spanStart).Order("bucket").Find(&dbFetchedReadings)
-			}
-		case (span >= 1*Day) && (span < 7*Day):
-			if stationName != "" {
-				r.DB.Table("weather_5m").Where("bucket > ?", spanStart).Where("stationname = ?", stationName).Order("bucket").Find(&dbFetchedReadings)
-			} else {
-				r.DB.Table("weather_5m").Where("bucket > ?", spanStart).Order("bucket").Find(&dbFetchedReadings)
-			}
-		case (span >= 7*Day) && (span < 2*Month):
-			if stationName != "" {
-				r.DB.Table("weather_1h").Where("bucket > ?", spanStart).Where("stationname = ?", stationName).Order("bucket").Find(&dbFetchedReadings)
-			} else {
-				r.DB.Table("weather_1h").Where("bucket > ?", spanStart).Order("bucket").Find(&dbFetchedReadings)
-			}
-		default:
-			if stationName != "" {
-				r.DB.Table("weather_1d").Where("bucket > ?", spanStart).Where("stationname = ?", stationName).Order("bucket").Find(&dbFetchedReadings)
-			} else {
-				r.DB.Table("weather_1d").Where("bucket > ?", spanStart).Order("bucket").Find(&dbFetchedReadings)
-			}
+		table, bucketInterval, err := spanTable(spanStart, span)
+		if err != nil {
+			log.Errorf("invalid request: %v", err)
+			http.Error(w, "error: no readings are retained for that span", 400)
+			return
 		}
 
+		r.DB.Table(table).Where("bucket > ?", spanStart).Where("stationname = ?", stationName).Order("bucket").Find(&dbFetchedReadings)
+
 		log.Debugf("returned rows: %v", len(dbFetchedReadings))
 		log.Debugf("getweatherspan -> spanDuration: %v", span)
 
+		maxPoints := defaultMaxSpanPoints
+		if mp := req.URL.Query().Get("maxpoints"); mp != "" {
+			maxPoints, err = strconv.Atoi(mp)
+			if err != nil || maxPoints < 3 {
+				http.Error(w, "error: maxpoints must be a number of at least 3", 400)
+				return
+			}
+		}
+
+		// Very long spans can return more points than a chart can usefully draw, so we
+		// thin them out.  The effective resolution tells the client how far apart the
+		// points it received are.
+		resolution := bucketInterval
+		gapInterval := bucketInterval
+		dbFetchedReadings, downsampledResolution := downsampleSpanReadings(dbFetchedReadings, maxPoints)
+		if downsampledResolution > 0 {
+			log.Debugf("downsampled span readings to %v rows", len(dbFetchedReadings))
+			resolution = downsampledResolution
+			// Downsampled points aren't evenly spaced, so only call it a gap if it's
+			// well beyond the average spacing
+			gapInterval = 2 * downsampledResolution
+		}
+
 		w.Header().Add("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Effective-Resolution", strconv.FormatInt(int64(resolution.Seconds()), 10))
+
+		spanReadings := r.transformSpanReadings(&dbFetchedReadings)
+		if req.URL.Query().Get("fillgaps") == "true" {
+			spanReadings = fillSpanGaps(spanReadings, gapInterval)
+		}
 
-		jsonResponse, err := json.Marshal(r.transformSpanReadings(&dbFetchedReadings))
+		jsonResponse, err := json.Marshal(spanReadings)
 		if err != nil {
 			log.Errorf("error marshalling dbFetchedReadings: %v", err)
 			http.Error(w, "error fetching readings from DB", 500)
@@ -328,6 +405,70 @@ func (r *RESTServerStorage) getWeatherSpan(w http.ResponseWriter, req *http.Requ
 	}
 }
 
+// spanTables are the tables that we can serve a span of time from, finest first.  minSpan
+// is the shortest span that we'd normally serve from the table, and retention is how long
+// the table's retention policy keeps data (see addRetentionPolicy*), or zero if the data
+// is kept forever.
+var spanTables = []struct {
+	table          string
+	bucketInterval time.Duration
+	minSpan        time.Duration
+	retention      time.Duration
+}{
+	{"weather_1m", time.Minute, 0, 1 * Month},
+	{"weather_5m", 5 * time.Minute, 1 * Day, 6 * Month},
+	{"weather_1h", time.Hour, 7 * Day, 24 * Month},
+	{"weather_1d", Day, 2 * Month, 0},
+}
+
+// spanTable returns the aggregate table that we query for a span of time beginning at
+// start, along with the width of that table's buckets.  We prefer the table suited to the
+// length of the span, but if its retention policy has already dropped data from the start
+// of the span, we fall back to the next coarser table that still has it.
+func spanTable(start time.Time, span time.Duration) (string, time.Duration, error) {
+	preferred := 0
+	for i, t := range spanTables {
+		if span >= t.minSpan {
+			preferred = i
+		}
+	}
+
+	age := time.Since(start)
+	for _, t := range spanTables[preferred:] {
+		if t.retention == 0 || age <= t.retention {
+			if t.table != spanTables[preferred].table {
+				log.Debugf("%v no longer has readings from %v; using %v instead", spanTables[preferred].table, start, t.table)
+			}
+			return t.table, t.bucketInterval, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("no table retains readings from %v", start)
+}
+
+// fillSpanGaps inserts a gap marker wherever a station is missing one or more buckets, so
+// that clients can break the line in their charts instead of drawing across the outage.
+// A marker is placed at the first missing bucket of each gap.
+func fillSpanGaps(readings []*WeatherReading, bucketInterval time.Duration) []*WeatherReading {
+	filled := make([]*WeatherReading, 0, len(readings))
+	lastBucket := make(map[string]int64)
+	interval := bucketInterval.Milliseconds()
+
+	for _, wr := range readings {
+		if last, ok := lastBucket[wr.StationName]; ok && wr.ReadingTimestamp-last > interval {
+			filled = append(filled, &WeatherReading{
+				StationName:      wr.StationName,
+				ReadingTimestamp: last + interval,
+				Gap:              true,
+			})
+		}
+		lastBucket[wr.StationName] = wr.ReadingTimestamp
+		filled = append(filled, wr)
+	}
+
+	return filled
+}
+
 func (r *RESTServerStorage) getWeatherLatest(w http.ResponseWriter, req *http.Request) {
 
 	if r.DBEnabled {
@@ -347,7 +488,12 @@ func (r *RESTServerStorage) getWeatherLatest(w http.ResponseWriter, req *http.Re
 		w.Header().Add("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Content-Type", "application/json")
 
-		jsonResponse, err := json.Marshal(r.transformLatestReadings(&dbFetchedReadings))
+		latest := r.transformLatestReadings(&dbFetchedReadings)
+		if latest.StationName != "" {
+			r.addPressureTendency(latest)
+		}
+
+		jsonResponse, err := json.Marshal(latest)
 		if err != nil {
 			log.Errorf("error marshalling dbFetchedReadings: %v", err)
 			http.Error(w, "error fetching readings from DB", 500)
@@ -358,6 +504,378 @@ func (r *RESTServerStorage) getWeatherLatest(w http.ResponseWriter, req *http.Re
 	}
 }
 
+// addPressureTendency fills in the pressure tendency for a latest reading, using the
+// station's barometer readings from the weather_5m aggregate over the last three hours
+func (r *RESTServerStorage) addPressureTendency(wr *WeatherReading) {
+	var pressures []float32
+
+	err := r.DB.Table("weather_5m").
+		Where("bucket > ?", time.Now().Add(-3*time.Hour)).
+		Where("stationname = ?", wr.StationName).
+		Where("barometer > 0").
+		Order("bucket").
+		Pluck("barometer", &pressures).Error
+	if err != nil {
+		log.Errorf("error fetching barometer readings for pressure tendency: %v", err)
+		return
+	}
+
+	code, arrow, ok := calcPressureTendency(pressures)
+	if !ok {
+		return
+	}
+
+	wr.PressureTendency = &code
+	wr.PressureArrow = arrow
+}
+
+// getRollingRain returns the rain totals over the last hour and last 24 hours
+func (r *RESTServerStorage) getRollingRain(w http.ResponseWriter, req *http.Request) {
+	if r.DBEnabled {
+		stationName := req.URL.Query().Get("station")
+		if stationName == "" {
+			// Client did not supply a station name, so pull from the configurated PullFromDevice
+			stationName = r.WeatherSiteConfig.PullFromDevice
+		}
+
+		rain, err := r.fetchRollingRain(stationName)
+		if err != nil {
+			log.Errorf("error fetching rolling rain: %v", err)
+			http.Error(w, "error fetching readings from DB", 500)
+			return
+		}
+
+		w.Header().Add("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+
+		jsonResponse, err := json.Marshal(rain)
+		if err != nil {
+			log.Errorf("error marshalling rolling rain: %v", err)
+			http.Error(w, "error fetching readings from DB", 500)
+			return
+		}
+
+		w.Write(jsonResponse)
+	}
+}
+
+// fetchRollingRain sums the incremental rain for a station over the last hour and last 24
+// hours.  Results are cached briefly since every page load asks for them.
+func (r *RESTServerStorage) fetchRollingRain(stationName string) (*RollingRain, error) {
+	r.rollingRainCacheMu.Lock()
+	defer r.rollingRainCacheMu.Unlock()
+
+	if cached, ok := r.rollingRainCache[stationName]; ok {
+		if time.Since(time.UnixMilli(cached.Timestamp)) < rollingRainCacheTTL {
+			return cached, nil
+		}
+	}
+
+	var totals struct {
+		LastHour    float32 `gorm:"column:last_hour"`
+		Last24Hours float32 `gorm:"column:last_24h"`
+	}
+
+	now := time.Now()
+
+	// Both windows are summed in a single pass over the last 24 hours of the raw table
+	err := r.DB.Table("weather").
+		Select("COALESCE(SUM(rainincremental) FILTER (WHERE time > ?), 0) AS last_hour, COALESCE(SUM(rainincremental), 0) AS last_24h", now.Add(-time.Hour)).
+		Where("stationname = ?", stationName).
+		Where("time > ?", now.Add(-24*time.Hour)).
+		Scan(&totals).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rain := &RollingRain{
+		StationName: stationName,
+		Timestamp:   now.UnixMilli(),
+		LastHour:    float32ToJSONNumber(totals.LastHour),
+		Last24Hours: float32ToJSONNumber(totals.Last24Hours),
+	}
+	r.rollingRainCache[stationName] = rain
+
+	return rain, nil
+}
+
+// WindRose holds the frequency of wind from each direction, binned by speed.  Counts[i][j]
+// is the number of readings from sector i with a speed in bin j.  Bin j covers speeds from
+// SpeedBins[j] up to SpeedBins[j+1], and the last bin is open-ended.  Sectors are centered
+// on SectorCenters, starting with north.  Readings with speeds below windRoseCalmSpeed (or
+// below the first bin) have no meaningful direction and are counted as calm instead.
+type WindRose struct {
+	StationName   string    `json:"stationname"`
+	From          int64     `json:"from"`
+	To            int64     `json:"to"`
+	Source        string    `json:"source"`
+	SectorCenters []float64 `json:"sectorcenters"`
+	SpeedBins     []float64 `json:"speedbins"`
+	Counts        [][]int   `json:"counts"`
+	Calm          int       `json:"calm"`
+	Total         int       `json:"total"`
+}
+
+const windRoseCalmSpeed = 0.5
+
+var defaultWindRoseSpeedBins = []float64{0, 5, 10, 15, 20, 30}
+
+// getWindRose returns wind rose data for a station.  The time window is set with from and
+// to (RFC 3339) and defaults to the last 24 hours.  The number of sectors and the speed
+// bin boundaries can be set with sectors and bins (e.g. bins=0,5,10,20).
+func (r *RESTServerStorage) getWindRose(w http.ResponseWriter, req *http.Request) {
+	if r.DBEnabled {
+		q := req.URL.Query()
+
+		stationName := q.Get("station")
+		if stationName == "" {
+			stationName = r.WeatherSiteConfig.PullFromDevice
+		}
+
+		to := time.Now()
+		if q.Get("to") != "" {
+			t, err := time.Parse(time.RFC3339, q.Get("to"))
+			if err != nil {
+				http.Error(w, "error: invalid to time", 400)
+				return
+			}
+			to = t
+		}
+
+		from := to.Add(-Day)
+		if q.Get("from") != "" {
+			t, err := time.Parse(time.RFC3339, q.Get("from"))
+			if err != nil {
+				http.Error(w, "error: invalid from time", 400)
+				return
+			}
+			from = t
+		}
+
+		if !from.Before(to) {
+			http.Error(w, "error: from must be before to", 400)
+			return
+		}
+
+		sectors := 16
+		if q.Get("sectors") != "" {
+			n, err := strconv.Atoi(q.Get("sectors"))
+			if err != nil || n < 4 || n > 360 {
+				http.Error(w, "error: sectors must be a number between 4 and 360", 400)
+				return
+			}
+			sectors = n
+		}
+
+		bins := defaultWindRoseSpeedBins
+		if q.Get("bins") != "" {
+			bins = nil
+			for _, b := range strings.Split(q.Get("bins"), ",") {
+				f, err := strconv.ParseFloat(strings.TrimSpace(b), 64)
+				if err != nil || (len(bins) > 0 && f <= bins[len(bins)-1]) {
+					http.Error(w, "error: bins must be an increasing list of speeds", 400)
+					return
+				}
+				bins = append(bins, f)
+			}
+		}
+
+		table, _, err := spanTable(from, to.Sub(from))
+		if err != nil {
+			log.Errorf("invalid request: %v", err)
+			http.Error(w, "error: no readings are retained for that period", 400)
+			return
+		}
+
+		var readings []struct {
+			WindDir   float32 `gorm:"column:winddir"`
+			WindSpeed float32 `gorm:"column:windspeed"`
+		}
+		err = r.DB.Table(table).Select("winddir, windspeed").
+			Where("bucket > ? AND bucket <= ?", from, to).
+			Where("stationname = ?", stationName).
+			Where("winddir IS NOT NULL AND windspeed IS NOT NULL").
+			Find(&readings).Error
+		if err != nil {
+			log.Errorf("error fetching wind readings: %v", err)
+			http.Error(w, "error fetching readings from DB", 500)
+			return
+		}
+
+		rose := WindRose{
+			StationName:   stationName,
+			From:          from.UnixMilli(),
+			To:            to.UnixMilli(),
+			Source:        table,
+			SectorCenters: make([]float64, sectors),
+			SpeedBins:     bins,
+			Counts:        make([][]int, sectors),
+		}
+
+		sectorWidth := 360.0 / float64(sectors)
+		for i := range rose.Counts {
+			rose.SectorCenters[i] = float64(i) * sectorWidth
+			rose.Counts[i] = make([]int, len(bins))
+		}
+
+		for _, rd := range readings {
+			rose.Total++
+
+			speed := float64(rd.WindSpeed)
+			if speed < windRoseCalmSpeed || speed < bins[0] {
+				rose.Calm++
+				continue
+			}
+
+			// Shift by half a sector so that each sector is centered on its heading
+			sector := int(math.Mod(float64(rd.WindDir)+sectorWidth/2, 360) / sectorWidth)
+			if sector >= sectors {
+				sector = 0
+			}
+
+			bin := sort.SearchFloat64s(bins, speed)
+			if bin == len(bins) || bins[bin] != speed {
+				bin--
+			}
+
+			rose.Counts[sector][bin]++
+		}
+
+		w.Header().Add("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Content-Type", "application/json")
+
+		jsonResponse, err := json.Marshal(rose)
+		if err != nil {
+			log.Errorf("error marshalling wind rose: %v", err)
+			http.Error(w, "error fetching readings from DB", 500)
+			return
+		}
+
+		w.Write(jsonResponse)
+	}
+}
+
+// getStation returns the metadata for the station given with ?name=, or for the site's
+// pull-from-device if no name is given.  The site's name and about text only describe the
+// pull-from-device, so other stations are described by their config alone.
+func (r *RESTServerStorage) getStation(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("name")
+	if name == "" {
+		name = r.WeatherSiteConfig.PullFromDevice
+	}
+
+	var device *DeviceConfig
+	for i := range r.Devices {
+		if r.Devices[i].Name == name {
+			device = &r.Devices[i]
+			break
+		}
+	}
+
+	if device == nil {
+		http.Error(w, "error: no such station", 404)
+		return
+	}
+
+	station := StationMetadata{
+		Name:          device.Name,
+		DisplayName:   device.Name,
+		Type:          device.Type,
+		Group:         device.Group,
+		Latitude:      device.Location.Lat,
+		Longitude:     device.Location.Lon,
+		Altitude:      device.Altitude,
+		DerivedFields: make([]string, 0),
+	}
+
+	if r.WeatherSiteConfig.PullFromDevice == device.Name {
+		if r.WeatherSiteConfig.StationName != "" {
+			station.DisplayName = r.WeatherSiteConfig.StationName
+		}
+		station.Description = string(r.WeatherSiteConfig.AboutStationHTML)
+	}
+
+	if derivedFieldEnabled(device.DerivedFields.WindChill) {
+		station.DerivedFields = append(station.DerivedFields, "windchill")
+	}
+	if derivedFieldEnabled(device.DerivedFields.HeatIndex) {
+		station.DerivedFields = append(station.DerivedFields, "heatindex")
+	}
+	if derivedFieldEnabled(device.DerivedFields.PrecipType) {
+		station.DerivedFields = append(station.DerivedFields, "preciptype")
+	}
+	if derivedFieldEnabled(device.DerivedFields.DewPoint) {
+		station.DerivedFields = append(station.DerivedFields, "dewpoint")
+	}
+	if derivedFieldEnabled(device.DerivedFields.WetBulb) {
+		station.DerivedFields = append(station.DerivedFields, "wetbulb")
+	}
+	if derivedFieldEnabled(device.DerivedFields.AbsoluteHumidity) {
+		station.DerivedFields = append(station.DerivedFields, "absolutehumidity")
+	}
+
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	jsonResponse, err := json.Marshal(station)
+	if err != nil {
+		log.Errorf("error marshalling station metadata: %v", err)
+		http.Error(w, "error fetching station metadata", 500)
+		return
+	}
+
+	w.Write(jsonResponse)
+}
+
+// getStations lists our stations, optionally limited to a single group with ?group=
+func (r *RESTServerStorage) getStations(w http.ResponseWriter, req *http.Request) {
+	group := req.URL.Query().Get("group")
+
+	stations := make([]StationInfo, 0)
+	for _, d := range r.Devices {
+		if group != "" && d.Group != group {
+			continue
+		}
+		stations = append(stations, StationInfo{Name: d.Name, Type: d.Type, Group: d.Group})
+	}
+
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	jsonResponse, err := json.Marshal(stations)
+	if err != nil {
+		log.Errorf("error marshalling stations: %v", err)
+		http.Error(w, "error listing stations", 500)
+		return
+	}
+
+	w.Write(jsonResponse)
+}
+
+// getGroups returns a map of station group names to the names of the stations in each
+// group.  Stations without a group are not included.
+func (r *RESTServerStorage) getGroups(w http.ResponseWriter, req *http.Request) {
+	groups := make(map[string][]string)
+	for _, d := range r.Devices {
+		if d.Group == "" {
+			continue
+		}
+		groups[d.Group] = append(groups[d.Group], d.Name)
+	}
+
+	w.Header().Add("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+
+	jsonResponse, err := json.Marshal(groups)
+	if err != nil {
+		log.Errorf("error marshalling groups: %v", err)
+		http.Error(w, "error listing groups", 500)
+		return
+	}
+
+	w.Write(jsonResponse)
+}
+
 func (r *RESTServerStorage) getForecast(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	span := vars["span"]
@@ -430,6 +948,8 @@ func (r *RESTServerStorage) transformSpanReadings(dbReadings *[]BucketReading) [
 			OutsideHumidity:       float32ToJSONNumber(r.OutHumidity),
 			RainRate:              float32ToJSONNumber(r.RainRate),
 			RainIncremental:       float32ToJSONNumber(r.RainIncremental),
+			PeriodRain:            float32ToJSONNumber(r.PeriodRain),
+			MaxRainRate:           float32ToJSONNumber(r.MaxRainRate),
 			SolarWatts:            float32ToJSONNumber(r.SolarWatts),
 			SolarJoules:           float32ToJSONNumber(r.SolarJoules),
 			UV:                    float32ToJSONNumber(r.UV),
@@ -440,11 +960,17 @@ func (r *RESTServerStorage) transformSpanReadings(dbReadings *[]BucketReading) [
 			YearRain:              float32ToJSONNumber(r.YearRain),
 			Barometer:             float32ToJSONNumber(r.Barometer),
 			WindSpeed:             float32ToJSONNumber(r.WindSpeed),
-			WindDirection:         float32ToJSONNumber(r.WindDir),
-			CardinalDirection:     headingToCardinalDirection(r.WindDir),
+			MaxWindSpeed:          float32ToJSONNumber(r.MaxWindSpeed),
+			MaxWindGust:           float32ToJSONNumber(r.MaxWindGust),
+			WindDirection:         nullableFloat32ToJSONNumber(r.WindDir),
+			WindDirectionWeighted: nullableFloat32ToJSONNumber(r.WindDirWeighted),
+			CardinalDirection:     nullableHeadingToCardinalDirection(r.WindDir),
 			RainfallDay:           float32ToJSONNumber(r.DayRain),
 			WindChill:             float32ToJSONNumber(r.WindChill),
 			HeatIndex:             float32ToJSONNumber(r.HeatIndex),
+			DewPoint:              float32ToJSONNumber(r.DewPoint),
+			WetBulb:               float32ToJSONNumber(r.WetBulb),
+			AbsoluteHumidity:      float32ToJSONNumber(r.AbsoluteHumidity),
 			InsideTemperature:     float32ToJSONNumber(r.InTemp),
 			InsideHumidity:        float32ToJSONNumber(r.InHumidity),
 			ConsBatteryVoltage:    float32ToJSONNumber(r.ConsBatteryVoltage),
@@ -503,16 +1029,26 @@ func (r *RESTServerStorage) transformLatestReadings(dbReadings *[]BucketReading)
 		YearRain:              float32ToJSONNumber(latest.YearRain),
 		Barometer:             float32ToJSONNumber(latest.Barometer),
 		WindSpeed:             float32ToJSONNumber(latest.WindSpeed),
-		WindDirection:         float32ToJSONNumber(latest.WindDir),
-		CardinalDirection:     headingToCardinalDirection(latest.WindDir),
+		WindDirection:         nullableFloat32ToJSONNumber(latest.WindDir),
+		CardinalDirection:     nullableHeadingToCardinalDirection(latest.WindDir),
 		RainfallDay:           float32ToJSONNumber(latest.DayRain),
 		WindChill:             float32ToJSONNumber(latest.WindChill),
 		HeatIndex:             float32ToJSONNumber(latest.HeatIndex),
+		DewPoint:              float32ToJSONNumber(latest.DewPoint),
+		WetBulb:               float32ToJSONNumber(latest.WetBulb),
+		AbsoluteHumidity:      float32ToJSONNumber(latest.AbsoluteHumidity),
 		InsideTemperature:     float32ToJSONNumber(latest.InTemp),
 		InsideHumidity:        float32ToJSONNumber(latest.InHumidity),
 		ConsBatteryVoltage:    float32ToJSONNumber(latest.ConsBatteryVoltage),
 		StationBatteryVoltage: float32ToJSONNumber(latest.StationBatteryVoltage),
+		PrecipType:            latest.PrecipType,
+		PressureTrend:         nullableFloat32ToJSONNumber(latest.PressureTrend),
 	}
+
+	if latest.PressureTrend != nil {
+		reading.PressureTrendLabel = pressureTrendLabel(*latest.PressureTrend)
+	}
+
 	return &reading
 }
 
@@ -537,6 +1073,23 @@ func float32ToJSONNumber(f float32) json.Number {
 	return json.Number(s)
 }
 
+// nullableFloat32ToJSONNumber converts a value that may be NULL in the database.  NULLs
+// become an empty json.Number so that they are omitted from the response.
+func nullableFloat32ToJSONNumber(f *float32) json.Number {
+	if f == nil {
+		return ""
+	}
+	return float32ToJSONNumber(*f)
+}
+
+// nullableHeadingToCardinalDirection returns an empty direction for a NULL heading
+func nullableHeadingToCardinalDirection(f *float32) string {
+	if f == nil {
+		return ""
+	}
+	return headingToCardinalDirection(*f)
+}
+
 func headingToCardinalDirection(f float32) string {
 	cardDirections := []string{"N", "NNE", "NE", "ENE",
 		"E", "ESE", "SE", "SSE",
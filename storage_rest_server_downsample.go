@@ -0,0 +1,127 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// defaultMaxSpanPoints is the most points per station that we'll return for a /span
+// request before downsampling, unless the client asks for a different limit
+const defaultMaxSpanPoints = 2500
+
+// downsampleSpanReadings reduces each station's readings to at most maxPoints using the
+// largest-triangle-three-buckets algorithm, which keeps the peaks and troughs that make
+// a chart look right.  Outside temperature is used to pick the points to keep, and the
+// rain and peak wind of the points that are dropped are folded into the kept ones.  It returns
+// the downsampled readings, in time order, along with the average spacing between the
+// returned points, or zero if no downsampling was needed.
+func downsampleSpanReadings(readings []BucketReading, maxPoints int) ([]BucketReading, time.Duration) {
+	var stations []string
+	byStation := make(map[string][]BucketReading)
+	for _, r := range readings {
+		if _, ok := byStation[r.StationName]; !ok {
+			stations = append(stations, r.StationName)
+		}
+		byStation[r.StationName] = append(byStation[r.StationName], r)
+	}
+
+	downsampled := false
+	var resolution time.Duration
+	result := make([]BucketReading, 0, len(readings))
+
+	for _, s := range stations {
+		sr := byStation[s]
+		if len(sr) > maxPoints {
+			span := sr[len(sr)-1].Bucket.Sub(sr[0].Bucket)
+			sr = lttb(sr, maxPoints)
+			downsampled = true
+			if r := span / time.Duration(len(sr)-1); r > resolution {
+				resolution = r
+			}
+		}
+		result = append(result, sr...)
+	}
+
+	if !downsampled {
+		return readings, 0
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Bucket.Before(result[j].Bucket)
+	})
+
+	return result, resolution
+}
+
+// lttb implements largest-triangle-three-buckets downsampling.  The first and last points
+// are always kept.  The points in between are divided into threshold-2 buckets, and from
+// each bucket we keep the point that forms the largest triangle with the point kept from
+// the previous bucket and the average of the next bucket.
+func lttb(data []BucketReading, threshold int) []BucketReading {
+	if threshold >= len(data) || threshold < 3 {
+		return data
+	}
+
+	sampled := make([]BucketReading, 0, threshold)
+	sampled = append(sampled, data[0])
+
+	x := func(i int) float64 { return float64(data[i].Bucket.UnixMilli()) }
+	y := func(i int) float64 { return float64(data[i].OutTemp) }
+
+	every := float64(len(data)-2) / float64(threshold-2)
+	a := 0
+
+	for i := 0; i < threshold-2; i++ {
+		// Average the next bucket to use as the third point of our triangles
+		nextStart := int(math.Floor(float64(i+1)*every)) + 1
+		nextEnd := int(math.Floor(float64(i+2)*every)) + 1
+		if nextEnd > len(data) {
+			nextEnd = len(data)
+		}
+
+		var avgX, avgY float64
+		for j := nextStart; j < nextEnd; j++ {
+			avgX += x(j)
+			avgY += y(j)
+		}
+		n := float64(nextEnd - nextStart)
+		avgX /= n
+		avgY /= n
+
+		// Find the point in this bucket with the largest triangle
+		start := int(math.Floor(float64(i)*every)) + 1
+		end := int(math.Floor(float64(i+1)*every)) + 1
+
+		maxArea := -1.0
+		next := start
+		for j := start; j < end; j++ {
+			area := math.Abs((x(a)-avgX)*(y(j)-y(a))-(x(a)-x(j))*(avgY-y(a))) / 2
+			if area > maxArea {
+				maxArea = area
+				next = j
+			}
+		}
+
+		kept := data[next]
+		for j := start; j < end; j++ {
+			if j != next {
+				foldDroppedReading(&kept, data[j])
+			}
+		}
+
+		sampled = append(sampled, kept)
+		a = next
+	}
+
+	return append(sampled, data[len(data)-1])
+}
+
+// foldDroppedReading folds a reading that downsampling drops into the reading kept in its
+// place, so that the rain that fell and the peak wind and rain rate aren't lost with it
+func foldDroppedReading(kept *BucketReading, dropped BucketReading) {
+	kept.PeriodRain += dropped.PeriodRain
+	kept.MaxWindSpeed = max(kept.MaxWindSpeed, dropped.MaxWindSpeed)
+	kept.MaxWindGust = max(kept.MaxWindGust, dropped.MaxWindGust)
+	kept.MaxRainRate = max(kept.MaxRainRate, dropped.MaxRainRate)
+}
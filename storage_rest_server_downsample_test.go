@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDownsampleKeepsRainAndPeaks(t *testing.T) {
+	start := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	var readings []BucketReading
+	var totalRain float32
+	for i := 0; i < 1000; i++ {
+		r := BucketReading{Bucket: start.Add(time.Duration(i) * time.Minute)}
+		r.StationName = "test"
+		r.OutTemp = float32(60 + 10*math.Sin(float64(i)/50))
+		r.MaxWindSpeed = 5
+		r.MaxWindGust = 8
+		if i%7 == 0 {
+			r.PeriodRain = 0.01
+			totalRain += r.PeriodRain
+		}
+		readings = append(readings, r)
+	}
+
+	// A brief squall that's unlikely to be one of the points picked by temperature
+	readings[501].MaxWindGust = 45
+	readings[501].MaxWindSpeed = 30
+	readings[501].MaxRainRate = 2.5
+
+	sampled, resolution := downsampleSpanReadings(readings, 50)
+	if len(sampled) != 50 {
+		t.Fatalf("downsampled to %v readings, want 50", len(sampled))
+	}
+	if resolution == 0 {
+		t.Error("resolution is zero after downsampling")
+	}
+
+	var sampledRain, peakGust, peakWind, peakRainRate float32
+	for _, r := range sampled {
+		sampledRain += r.PeriodRain
+		peakGust = max(peakGust, r.MaxWindGust)
+		peakWind = max(peakWind, r.MaxWindSpeed)
+		peakRainRate = max(peakRainRate, r.MaxRainRate)
+	}
+
+	if math.Abs(float64(sampledRain-totalRain)) > 1e-4 {
+		t.Errorf("downsampled readings hold %v of rain, want %v", sampledRain, totalRain)
+	}
+	if peakGust != 45 || peakWind != 30 || peakRainRate != 2.5 {
+		t.Errorf("downsampled peaks are gust %v, wind %v, rain rate %v; want 45, 30, and 2.5", peakGust, peakWind, peakRainRate)
+	}
+}
+
+func TestDownsampleUnderLimit(t *testing.T) {
+	readings := make([]BucketReading, 10)
+	sampled, resolution := downsampleSpanReadings(readings, 50)
+	if len(sampled) != 10 || resolution != 0 {
+		t.Errorf("got %v readings at resolution %v, want the 10 readings untouched", len(sampled), resolution)
+	}
+}
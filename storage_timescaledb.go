@@ -1,27 +1,100 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
+	"gorm.io/gorm/schema"
 )
 
 // TimescaleDBConfig describes the YAML-provided configuration for a TimescaleDB
 // storage backend
 type TimescaleDBConfig struct {
-	ConnectionString string `yaml:"connection-string"`
+	ConnectionString    string                    `yaml:"connection-string"`
+	AggregationPolicies AggregationPoliciesConfig `yaml:"aggregation-policies,omitempty"`
+	RetryQueueSize      int                       `yaml:"retry-queue-size,omitempty"`
+	RetryInterval       string                    `yaml:"retry-interval,omitempty"`
+	RetryMaxAttempts    int                       `yaml:"retry-max-attempts,omitempty"`
+	SpillFile           string                    `yaml:"spill-file,omitempty"`
+	SpillSignal         string                    `yaml:"spill-signal,omitempty"`
+	// CircularAvgMinMagnitude is the shortest mean direction vector, between 0 and 1, for
+	// which the aggregates report an average wind direction
+	CircularAvgMinMagnitude float64 `yaml:"circular-avg-min-magnitude,omitempty"`
+	// RecreateOutdatedAggregates drops and re-creates the continuous aggregates at startup
+	// if they lack columns that this version adds.  The re-created aggregates can only be
+	// filled from the readings still in the weather hypertable, so older history in the
+	// aggregates is lost.
+	RecreateOutdatedAggregates bool `yaml:"recreate-outdated-aggregates,omitempty"`
+}
+
+// AggregationPoliciesConfig holds the refresh policies for each of our continuous aggregates
+type AggregationPoliciesConfig struct {
+	OneMinute  AggregationPolicy `yaml:"1m,omitempty"`
+	FiveMinute AggregationPolicy `yaml:"5m,omitempty"`
+	OneHour    AggregationPolicy `yaml:"1h,omitempty"`
+	OneDay     AggregationPolicy `yaml:"1d,omitempty"`
+}
+
+// AggregationPolicy describes how TimescaleDB refreshes a continuous aggregate.  Buckets
+// between start-offset and end-offset ago are refreshed every schedule-interval.  All three
+// are PostgreSQL intervals (e.g. "2 days", "1 minute").  Any that are left unset will use
+// our defaults.
+type AggregationPolicy struct {
+	StartOffset      string `yaml:"start-offset,omitempty"`
+	EndOffset        string `yaml:"end-offset,omitempty"`
+	ScheduleInterval string `yaml:"schedule-interval,omitempty"`
 }
 
 // TimescaleDBStorage holds the configuration for a TimescaleDB storage backend
 type TimescaleDBStorage struct {
 	TimescaleDBConn *gorm.DB
+	// retryQueue holds readings that we failed to store, oldest first, so that a brief
+	// database outage doesn't lose them.  It's only touched by processMetrics.
+	retryQueue       []queuedReading
+	retryQueueSize   int
+	retryInterval    time.Duration
+	retryMaxAttempts int
+	retryDropped     uint64
+	// spillFile is where the retry queue is written when power is failing or we shut down
+	// with readings still queued, so that they can be stored after we restart
+	spillFile   string
+	spillSignal os.Signal
+	// circularAvgMinMagnitude is passed to the circular average finalizers
+	circularAvgMinMagnitude float64
+	// storeFields holds, for stations that configure store-fields, the only columns that
+	// we write for that station's readings
+	storeFields map[string][]string
 }
 
+// queuedReading is a reading in the retry queue, along with the number of times that
+// storing it has failed for a reason other than losing the database connection
+type queuedReading struct {
+	Reading
+	attempts int
+}
+
+const (
+	defaultRetryQueueSize   = 1000
+	defaultRetryInterval    = 30 * time.Second
+	defaultRetryMaxAttempts = 10
+	// defaultCircularAvgMinMagnitude is low enough that only wind coming from all
+	// around the compass yields no average direction
+	defaultCircularAvgMinMagnitude = 0.05
+)
+
 // We declare the Tabler interface for purposes of customizing the table name in the DB
 type Tabler interface {
 	TableName() string
@@ -30,6 +103,17 @@ type Tabler interface {
 // BucketReading holds a reading for a given timestamp
 type BucketReading struct {
 	Bucket time.Time `gorm:"column:bucket"`
+	// WindDir shadows Reading.WindDir because the aggregates' average direction is NULL
+	// when the directions in the bucket cancel out
+	WindDir *float32 `gorm:"column:winddir"`
+	// WindDirWeighted is only present in the aggregates, and is NULL when the wind was
+	// calm for the whole bucket
+	WindDirWeighted *float32 `gorm:"column:winddir_weighted"`
+	// PeriodRain and the maximums are also only present in the aggregates
+	PeriodRain   float32 `gorm:"column:period_rain"`
+	MaxWindSpeed float32 `gorm:"column:max_windspeed"`
+	MaxWindGust  float32 `gorm:"column:max_windgust"`
+	MaxRainRate  float32 `gorm:"column:max_rainrate"`
 	Reading
 }
 
@@ -43,19 +127,74 @@ func (Reading) TableName() string {
 func (t *TimescaleDBStorage) StartStorageEngine(ctx context.Context, wg *sync.WaitGroup) chan<- Reading {
 	log.Info("starting TimescaleDB storage engine...")
 	readingChan := make(chan Reading, 10)
-	go t.processMetrics(ctx, wg, readingChan)
+	go t.processMetrics(ctx, wg, readingChan, nil)
 	return readingChan
 }
 
-func (t *TimescaleDBStorage) processMetrics(ctx context.Context, wg *sync.WaitGroup, rchan <-chan Reading) {
+// startFromQueue starts the engine reading from the storage manager's queue for it rather
+// than from a channel of its own.  queueDone is closed once nothing more will be added
+// to the queue, which lets us spill every reading left in it when we shut down.
+func (t *TimescaleDBStorage) startFromQueue(ctx context.Context, wg *sync.WaitGroup, queue <-chan Reading, queueDone <-chan struct{}) {
+	log.Info("starting TimescaleDB storage engine...")
+	go t.processMetrics(ctx, wg, queue, queueDone)
+}
+
+func (t *TimescaleDBStorage) processMetrics(ctx context.Context, wg *sync.WaitGroup, rchan <-chan Reading, rchanDone <-chan struct{}) {
 	wg.Add(1)
 	defer wg.Done()
 
+	ticker := time.NewTicker(t.retryInterval)
+	defer ticker.Stop()
+
+	// A nil channel never receives, so this case is disabled unless a spill signal is set
+	var spillSigs chan os.Signal
+	if t.spillSignal != nil {
+		spillSigs = make(chan os.Signal, 1)
+		signal.Notify(spillSigs, t.spillSignal)
+		defer signal.Stop(spillSigs)
+	}
+
 	for {
 		select {
+		case sig := <-spillSigs:
+			// Power is failing.  Store what we can now and spill the rest to disk in case
+			// we go down.  If power comes back, we carry on as normal.
+			log.Warnf("received %v; flushing TimescaleDB retry queue", sig)
+			t.queuePendingReadings(rchan)
+			t.retryQueuedReadings(ctx)
+			t.spillRetryQueue()
 		case r := <-rchan:
-			t.StoreReading(ctx, r)
+			// Readings must be stored in the order they arrived, so while anything is
+			// queued, new readings wait their turn behind it
+			if len(t.retryQueue) > 0 {
+				t.queueForRetry(r)
+				t.retryQueuedReadings(ctx)
+				continue
+			}
+
+			err := t.StoreReading(ctx, r)
+			if err != nil {
+				if isPermanentStoreError(err) {
+					log.Errorf("could not store reading from %v at %v; dropping it: %v", r.StationName, r.Timestamp, err)
+					continue
+				}
+				log.Error("could not store reading:", err)
+				t.queueForRetry(r)
+			}
+		case <-ticker.C:
+			t.retryQueuedReadings(ctx)
 		case <-ctx.Done():
+			if t.spillFile != "" {
+				// Readings still waiting for us would be lost along with the process, so
+				// once nothing more is coming, spill them with the retry queue
+				if rchanDone != nil {
+					<-rchanDone
+				}
+				t.queuePendingReadings(rchan)
+				t.spillRetryQueue()
+			} else if len(t.retryQueue) > 0 {
+				log.Warnf("%v readings in the TimescaleDB retry queue were not stored", len(t.retryQueue))
+			}
 			log.Info("cancellation request recieved.  Cancelling readings processor.")
 			return
 		}
@@ -63,18 +202,319 @@ func (t *TimescaleDBStorage) processMetrics(ctx context.Context, wg *sync.WaitGr
 }
 
 // StoreReading stores a reading value in TimescaleDB
-func (t *TimescaleDBStorage) StoreReading(ctx context.Context, r Reading) {
-	err := t.TimescaleDBConn.WithContext(ctx).Create(&r).Error
+func (t *TimescaleDBStorage) StoreReading(ctx context.Context, r Reading) error {
+	if fields, ok := t.storeFields[r.StationName]; ok {
+		return t.TimescaleDBConn.WithContext(ctx).Select(fields).Create(&r).Error
+	}
+	return t.TimescaleDBConn.WithContext(ctx).Create(&r).Error
+}
+
+// setStoreFields builds the column list for each device that limits the fields it stores.
+// Every reading needs its time and station name, so those are always written.  So are the
+// fields we calculate at ingest: the derived fields that are enabled for the device, the
+// pressure trend, and, if the device has a gust window, the wind gust.
+func (t *TimescaleDBStorage) setStoreFields(devices []DeviceConfig) error {
+	readingSchema, err := schema.Parse(&Reading{}, &sync.Map{}, t.TimescaleDBConn.NamingStrategy)
+	if err != nil {
+		return fmt.Errorf("could not parse reading schema: %v", err)
+	}
+
+	t.storeFields = make(map[string][]string)
+
+	for _, d := range devices {
+		if len(d.StoreFields) == 0 {
+			continue
+		}
+
+		fields := []string{"time", "stationname"}
+		listed := map[string]bool{"time": true, "stationname": true}
+		for _, f := range d.StoreFields {
+			if readingSchema.LookUpField(f) == nil {
+				return fmt.Errorf("store-fields for device %v includes unknown field %v", d.Name, f)
+			}
+			if !listed[f] {
+				fields = append(fields, f)
+				listed[f] = true
+			}
+		}
+
+		for _, df := range []struct {
+			setting *bool
+			column  string
+		}{
+			{d.DerivedFields.WindChill, "windchill"},
+			{d.DerivedFields.HeatIndex, "heatindex"},
+			{d.DerivedFields.DewPoint, "dewpoint"},
+			{d.DerivedFields.WetBulb, "wetbulb"},
+			{d.DerivedFields.AbsoluteHumidity, "absolutehumidity"},
+			{d.DerivedFields.PrecipType, "preciptype"},
+		} {
+			if derivedFieldEnabled(df.setting) && !listed[df.column] {
+				fields = append(fields, df.column)
+				listed[df.column] = true
+			}
+		}
+
+		calculated := []string{"pressuretrend"}
+		if d.GustWindow != "" {
+			calculated = append(calculated, "windgust")
+		}
+		for _, column := range calculated {
+			if !listed[column] {
+				fields = append(fields, column)
+				listed[column] = true
+			}
+		}
+
+		log.Infof("storing only %v of %v fields for device %v", len(fields), len(readingSchema.DBNames), d.Name)
+		t.storeFields[d.Name] = fields
+	}
+
+	return nil
+}
+
+// queueForRetry adds a reading that we couldn't store to the retry queue.  If the queue
+// is full, the oldest reading is dropped to make room.
+func (t *TimescaleDBStorage) queueForRetry(r Reading) {
+	if len(t.retryQueue) >= t.retryQueueSize {
+		t.retryQueue = t.retryQueue[1:]
+		t.retryDropped++
+		log.Warnf("TimescaleDB retry queue is full; dropped oldest reading (%v dropped so far)", t.retryDropped)
+	}
+
+	t.retryQueue = append(t.retryQueue, queuedReading{Reading: r})
+	log.Infof("queued reading for retry; TimescaleDB retry queue depth is %v", len(t.retryQueue))
+}
+
+// queuePendingReadings moves the readings waiting in rchan to the end of the retry queue so
+// that they're spilled along with it
+func (t *TimescaleDBStorage) queuePendingReadings(rchan <-chan Reading) {
+	for {
+		select {
+		case r := <-rchan:
+			t.queueForRetry(r)
+		default:
+			return
+		}
+	}
+}
+
+// retryQueuedReadings tries to store the queued readings, oldest first.  It stops at the
+// first reading that can't be stored yet so that readings are stored in order.  A reading
+// that fails with a permanent error, or that has failed retry-max-attempts times, is
+// dropped so that it can't hold up the rest of the queue.
+func (t *TimescaleDBStorage) retryQueuedReadings(ctx context.Context) {
+	if len(t.retryQueue) == 0 {
+		return
+	}
+
+	stored, dropped := 0, 0
+	i := 0
+	for ; i < len(t.retryQueue); i++ {
+		q := &t.retryQueue[i]
+
+		err := t.StoreReading(ctx, q.Reading)
+		if err == nil {
+			stored++
+			continue
+		}
+
+		if isConnectionError(err) {
+			// The database is most likely still unavailable, which isn't the reading's fault
+			log.Warnf("retry of queued readings failed: %v", err)
+			break
+		}
+
+		if isPermanentStoreError(err) {
+			log.Errorf("could not store queued reading from %v at %v; dropping it: %v", q.StationName, q.Timestamp, err)
+		} else {
+			q.attempts++
+			if q.attempts < t.retryMaxAttempts {
+				log.Warnf("retry of queued reading failed (attempt %v of %v): %v", q.attempts, t.retryMaxAttempts, err)
+				break
+			}
+			log.Errorf("could not store queued reading from %v at %v; dropping it after %v attempts: %v",
+				q.StationName, q.Timestamp, q.attempts, err)
+		}
+
+		t.retryDropped++
+		dropped++
+	}
+
+	// Copy the remainder so the queue's backing array doesn't grow without bound
+	t.retryQueue = append([]queuedReading(nil), t.retryQueue[i:]...)
+
+	if stored > 0 || dropped > 0 {
+		log.Infof("stored %v and dropped %v queued readings; TimescaleDB retry queue depth is %v", stored, dropped, len(t.retryQueue))
+	}
+
+	// Once everything has been stored, a spill file is out of date and would store
+	// duplicates if we loaded it after a restart
+	if len(t.retryQueue) == 0 && t.spillFile != "" {
+		err := os.Remove(t.spillFile)
+		if err != nil && !os.IsNotExist(err) {
+			log.Errorf("error removing spill file %v: %v", t.spillFile, err)
+		}
+	}
+}
+
+// sqlStateClass returns the two-character SQLSTATE class of an error returned by
+// PostgreSQL, or "" if err didn't come from PostgreSQL itself
+func sqlStateClass(err error) string {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || len(pgErr.Code) < 2 {
+		return ""
+	}
+	return pgErr.Code[:2]
+}
+
+// isConnectionError reports whether err means that we couldn't talk to the database, as
+// opposed to the database rejecting the reading.  Errors that didn't come from PostgreSQL
+// (e.g. a refused connection) count as connection errors.
+func isConnectionError(err error) bool {
+	switch sqlStateClass(err) {
+	case "", // not from PostgreSQL
+		"08", // connection exception
+		"57": // operator intervention, e.g. the server is shutting down
+		return true
+	}
+	return false
+}
+
+// isPermanentStoreError reports whether retrying a reading that failed with err would
+// fail the same way.  Only connection errors and the SQLSTATE classes for conflicts and
+// exhausted resources are worth retrying.
+func isPermanentStoreError(err error) bool {
+	if isConnectionError(err) {
+		return false
+	}
+
+	switch sqlStateClass(err) {
+	case "40", // transaction rollback, e.g. a deadlock or serialization failure
+		"53", // insufficient resources
+		"55", // object not in prerequisite state, e.g. a lock isn't available
+		"58": // system error, e.g. an I/O error
+		return false
+	}
+	return true
+}
+
+// spillRetryQueue writes the retry queue to the spill file, one JSON-encoded reading per
+// line.  JSON can't represent NaN or infinite values, so readings holding them are
+// skipped rather than losing the whole queue.
+func (t *TimescaleDBStorage) spillRetryQueue() {
+	if t.spillFile == "" || len(t.retryQueue) == 0 {
+		return
+	}
+
+	var data bytes.Buffer
+	spilled := 0
+	for _, q := range t.retryQueue {
+		line, err := json.Marshal(q.Reading)
+		if err != nil {
+			log.Errorf("could not spill queued reading from %v at %v; dropping it: %v", q.StationName, q.Timestamp, err)
+			continue
+		}
+		data.Write(line)
+		data.WriteByte('\n')
+		spilled++
+	}
+
+	// Write to a temporary file and rename it so that losing power mid-write can't leave
+	// us with a truncated spill file
+	tmp := t.spillFile + ".tmp"
+	err := os.WriteFile(tmp, data.Bytes(), 0600)
+	if err == nil {
+		err = os.Rename(tmp, t.spillFile)
+	}
+	if err != nil {
+		log.Errorf("error writing spill file %v: %v", t.spillFile, err)
+		return
+	}
+
+	log.Warnf("spilled %v of %v queued readings to %v", spilled, len(t.retryQueue), t.spillFile)
+}
+
+// loadSpillFile queues any readings left in the spill file by a previous run
+func (t *TimescaleDBStorage) loadSpillFile() error {
+	data, err := os.ReadFile(t.spillFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
 	if err != nil {
-		log.Error("could not store reading:", err)
+		return fmt.Errorf("error reading spill file %v: %v", t.spillFile, err)
+	}
+
+	var readings []Reading
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		// Earlier versions spilled the queue as a single JSON array
+		err = json.Unmarshal(data, &readings)
+		if err != nil {
+			return fmt.Errorf("error decoding spill file %v: %v", t.spillFile, err)
+		}
+	} else {
+		for i, line := range bytes.Split(data, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var r Reading
+			err = json.Unmarshal(line, &r)
+			if err != nil {
+				log.Errorf("skipping line %v of spill file %v: %v", i+1, t.spillFile, err)
+				continue
+			}
+			readings = append(readings, r)
+		}
 	}
+
+	for _, r := range readings {
+		t.queueForRetry(r)
+	}
+
+	log.Infof("loaded %v readings from spill file %v", len(readings), t.spillFile)
+
+	return nil
 }
 
 // NewTimescaleDBStorage sets up a new Graphite storage backend
 func NewTimescaleDBStorage(ctx context.Context, c *Config) (*TimescaleDBStorage, error) {
 
 	var err error
-	t := TimescaleDBStorage{}
+	t := TimescaleDBStorage{
+		retryQueueSize:   c.Storage.TimescaleDB.RetryQueueSize,
+		retryInterval:    defaultRetryInterval,
+		retryMaxAttempts: c.Storage.TimescaleDB.RetryMaxAttempts,
+	}
+
+	t.circularAvgMinMagnitude = c.Storage.TimescaleDB.CircularAvgMinMagnitude
+	if t.circularAvgMinMagnitude == 0 {
+		t.circularAvgMinMagnitude = defaultCircularAvgMinMagnitude
+	}
+
+	if t.circularAvgMinMagnitude < 0 || t.circularAvgMinMagnitude >= 1 {
+		return &TimescaleDBStorage{}, fmt.Errorf("circular-avg-min-magnitude must be between 0 and 1")
+	}
+
+	if t.retryQueueSize == 0 {
+		t.retryQueueSize = defaultRetryQueueSize
+	}
+
+	if t.retryMaxAttempts == 0 {
+		t.retryMaxAttempts = defaultRetryMaxAttempts
+	}
+	if t.retryMaxAttempts < 0 {
+		return &TimescaleDBStorage{}, fmt.Errorf("retry-max-attempts must be greater than zero")
+	}
+
+	if c.Storage.TimescaleDB.RetryInterval != "" {
+		t.retryInterval, err = time.ParseDuration(c.Storage.TimescaleDB.RetryInterval)
+		if err != nil {
+			return &TimescaleDBStorage{}, fmt.Errorf("invalid retry-interval %v: %v", c.Storage.TimescaleDB.RetryInterval, err)
+		}
+		if t.retryInterval <= 0 {
+			return &TimescaleDBStorage{}, fmt.Errorf("retry-interval must be greater than zero")
+		}
+	}
 
 	// Create a logger for gorm
 	dbLogger := logger.New(
@@ -94,6 +534,32 @@ func NewTimescaleDBStorage(ctx context.Context, c *Config) (*TimescaleDBStorage,
 		return &TimescaleDBStorage{}, err
 	}
 
+	if c.Storage.TimescaleDB.SpillFile != "" {
+		t.spillFile = c.Storage.TimescaleDB.SpillFile
+
+		spillSignal := c.Storage.TimescaleDB.SpillSignal
+		if spillSignal == "" {
+			spillSignal = defaultSpillSignal
+		}
+		if spillSignal != "" {
+			sig, ok := spillSignals[spillSignal]
+			if !ok {
+				return &TimescaleDBStorage{}, fmt.Errorf("unsupported spill-signal %v", spillSignal)
+			}
+			t.spillSignal = sig
+		}
+
+		err = t.loadSpillFile()
+		if err != nil {
+			return &TimescaleDBStorage{}, err
+		}
+	}
+
+	err = t.setStoreFields(c.Devices)
+	if err != nil {
+		return &TimescaleDBStorage{}, err
+	}
+
 	// Create the database table
 	log.Info("creating database table...")
 	err = t.TimescaleDBConn.WithContext(ctx).Exec(createTableSQL).Error
@@ -102,6 +568,16 @@ func NewTimescaleDBStorage(ctx context.Context, c *Config) (*TimescaleDBStorage,
 		return &TimescaleDBStorage{}, err
 	}
 
+	// Add any columns that are missing from an existing table
+	log.Info("adding new columns to database table...")
+	for _, sql := range addColumnsSQL {
+		err = t.TimescaleDBConn.WithContext(ctx).Exec(sql).Error
+		if err != nil {
+			log.Warn("warning: could not add column to table in database")
+			return &TimescaleDBStorage{}, err
+		}
+	}
+
 	// Create the TimescaleDB extension
 	log.Info("creating TimescaleDB extension...")
 	err = t.TimescaleDBConn.WithContext(ctx).Exec(createExtensionSQL).Error
@@ -150,7 +626,7 @@ func NewTimescaleDBStorage(ctx context.Context, c *Config) (*TimescaleDBStorage,
 
 	// Create the circular average finalizer function
 	log.Info("creating circular average state finalizer function...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(createCircAvgFinalizerFunctionSQL).Error
+	err = t.TimescaleDBConn.WithContext(ctx).Exec(fmt.Sprintf(createCircAvgFinalizerFunctionSQL, t.circularAvgMinMagnitude)).Error
 	if err != nil {
 		log.Warn("warning: could not create circular average state finalizer function")
 		return &TimescaleDBStorage{}, err
@@ -164,67 +640,54 @@ func NewTimescaleDBStorage(ctx context.Context, c *Config) (*TimescaleDBStorage,
 		return &TimescaleDBStorage{}, err
 	}
 
-	// Create the 1m view
-	log.Info("creating 1m view...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(create1mViewSQL).Error
-	if err != nil {
-		log.Warn("warning: could not create 1m view")
-		return &TimescaleDBStorage{}, err
-	}
-
-	// Create the 5m view
-	log.Info("creating 5m view...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(create5mViewSQL).Error
-	if err != nil {
-		log.Warn("warning: could not create 5m view")
-		return &TimescaleDBStorage{}, err
-	}
-
-	// Create the 1h view
-	log.Info("creating 1h view...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(create1hViewSQL).Error
-	if err != nil {
-		log.Warn("warning: could not create 1h view")
-		return &TimescaleDBStorage{}, err
-	}
-
-	// Create the 1d view
-	log.Info("Creating 1d view...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(create1dViewSQL).Error
-	if err != nil {
-		log.Warn("warning: could not create 1d view")
-		return &TimescaleDBStorage{}, err
-	}
-
-	// Add the 1m aggregation policy
-	log.Info("Adding 1m aggregation policy...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(addAggregationPolicy1mSQL).Error
-	if err != nil {
-		log.Warn("warning: could not add 1m aggregation policy")
-		return &TimescaleDBStorage{}, err
+	// Create the speed-weighted circular average functions
+	log.Info("creating speed-weighted circular average functions...")
+	for _, sql := range []string{
+		createCircAvgWeightedStateFunctionSQL,
+		fmt.Sprintf(createCircAvgWeightedFinalizerFunctionSQL, t.circularAvgMinMagnitude),
+		createCircAvgWeightedAggregateFunctionSQL,
+	} {
+		err = t.TimescaleDBConn.WithContext(ctx).Exec(sql).Error
+		if err != nil {
+			log.Warn("warning: could not create speed-weighted circular average functions")
+			return &TimescaleDBStorage{}, err
+		}
 	}
 
-	// Add the 5m aggregation policy
-	log.Info("Adding 5m aggregation policy...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(addAggregationPolicy5mSQL).Error
+	err = t.createAggregateViews(ctx)
 	if err != nil {
-		log.Warn("warning: could not add 5m aggregation policy")
 		return &TimescaleDBStorage{}, err
 	}
 
-	// Add the 1h aggregation policy
-	log.Info("Adding 1h aggregation policy...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(addAggregationPolicy1hSQL).Error
-	if err != nil {
-		log.Warn("warning: could not add 1h aggregation policy")
-		return &TimescaleDBStorage{}, err
+	// CREATE MATERIALIZED VIEW IF NOT EXISTS leaves views from an older version alone, so
+	// they may lack columns that we've since added
+	if missing := t.outdatedAggregateColumns(ctx); len(missing) > 0 {
+		if c.Storage.TimescaleDB.RecreateOutdatedAggregates {
+			log.Warnf("the continuous aggregates lack %v; re-creating them", strings.Join(missing, ", "))
+			for _, view := range aggregateViews {
+				err = t.TimescaleDBConn.WithContext(ctx).Exec(fmt.Sprintf(dropAggregateViewSQL, view.name)).Error
+				if err != nil {
+					log.Warnf("warning: could not drop %v view", view.name)
+					return &TimescaleDBStorage{}, err
+				}
+			}
+
+			err = t.createAggregateViews(ctx)
+			if err != nil {
+				return &TimescaleDBStorage{}, err
+			}
+		} else {
+			log.Warnf("the continuous aggregates were created by an older version and lack %v.  "+
+				"Set recreate-outdated-aggregates to re-create them, which loses aggregate history "+
+				"older than the weather table's retention.", strings.Join(missing, ", "))
+		}
 	}
 
-	// Add the 1d aggregation policy
-	log.Info("Adding 1d aggregation policy...")
-	err = t.TimescaleDBConn.WithContext(ctx).Exec(addAggregationPolicy1dSQL).Error
+	// Add the aggregation policies
+	log.Info("Adding aggregation policies...")
+	err = t.addAggregationPolicies(ctx, c.Storage.TimescaleDB.AggregationPolicies)
 	if err != nil {
-		log.Warn("warning: could not add 1d aggregation policy")
+		log.Warn("warning: could not add aggregation policies")
 		return &TimescaleDBStorage{}, err
 	}
 
@@ -262,3 +725,103 @@ func NewTimescaleDBStorage(ctx context.Context, c *Config) (*TimescaleDBStorage,
 
 	return &t, nil
 }
+
+// aggregateViews are our continuous aggregates and the SQL that creates them
+var aggregateViews = []struct {
+	name string
+	sql  string
+}{
+	{"weather_1m", create1mViewSQL},
+	{"weather_5m", create5mViewSQL},
+	{"weather_1h", create1hViewSQL},
+	{"weather_1d", create1dViewSQL},
+}
+
+// createAggregateViews creates any continuous aggregates that don't exist yet
+func (t *TimescaleDBStorage) createAggregateViews(ctx context.Context) error {
+	for _, view := range aggregateViews {
+		log.Infof("creating %v view...", view.name)
+		err := t.TimescaleDBConn.WithContext(ctx).Exec(view.sql).Error
+		if err != nil {
+			log.Warnf("warning: could not create %v view", view.name)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// outdatedAggregateColumns returns a description of each column that was added to the
+// continuous aggregates after they were created and is missing from any of them
+func (t *TimescaleDBStorage) outdatedAggregateColumns(ctx context.Context) []string {
+	var missing []string
+
+	for _, col := range []struct {
+		column      string
+		description string
+	}{
+		{"winddir_weighted", "speed-weighted wind direction"},
+		{"max_windgust", "wind gust"},
+		{"dewpoint", "dew point"},
+		{"wetbulb", "wet-bulb temperature"},
+		{"absolutehumidity", "absolute humidity"},
+	} {
+		for _, view := range aggregateViews {
+			var found int64
+			err := t.TimescaleDBConn.WithContext(ctx).Raw(checkAggregateColumnSQL, view.name, col.column).Scan(&found).Error
+			if err != nil {
+				log.Warnf("warning: could not check %v for %v column: %v", view.name, col.column, err)
+				continue
+			}
+			if found == 0 {
+				missing = append(missing, fmt.Sprintf("the %v (%v)", col.description, col.column))
+				break
+			}
+		}
+	}
+
+	return missing
+}
+
+// addAggregationPolicies (re)creates the refresh policy for each continuous aggregate,
+// filling in our defaults for anything not set in the config
+func (t *TimescaleDBStorage) addAggregationPolicies(ctx context.Context, c AggregationPoliciesConfig) error {
+	policies := []struct {
+		view     string
+		policy   AggregationPolicy
+		defaults AggregationPolicy
+	}{
+		{"weather_1m", c.OneMinute, AggregationPolicy{"2 days", "1 minute", "1 minute"}},
+		{"weather_5m", c.FiveMinute, AggregationPolicy{"2 days", "5 minutes", "5 minutes"}},
+		{"weather_1h", c.OneHour, AggregationPolicy{"2 months", "1 hour", "1 hour"}},
+		{"weather_1d", c.OneDay, AggregationPolicy{"1 year", "1 day", "1 day"}},
+	}
+
+	for _, p := range policies {
+		if p.policy.StartOffset == "" {
+			p.policy.StartOffset = p.defaults.StartOffset
+		}
+		if p.policy.EndOffset == "" {
+			p.policy.EndOffset = p.defaults.EndOffset
+		}
+		if p.policy.ScheduleInterval == "" {
+			p.policy.ScheduleInterval = p.defaults.ScheduleInterval
+		}
+
+		log.Infof("setting %v aggregation policy: start-offset %v, end-offset %v, schedule-interval %v",
+			p.view, p.policy.StartOffset, p.policy.EndOffset, p.policy.ScheduleInterval)
+
+		err := t.TimescaleDBConn.WithContext(ctx).Exec(removeAggregationPolicySQL, p.view).Error
+		if err != nil {
+			return fmt.Errorf("could not remove existing %v aggregation policy: %v", p.view, err)
+		}
+
+		err = t.TimescaleDBConn.WithContext(ctx).Exec(addAggregationPolicySQL, p.view,
+			p.policy.StartOffset, p.policy.EndOffset, p.policy.ScheduleInterval).Error
+		if err != nil {
+			return fmt.Errorf("could not add %v aggregation policy: %v", p.view, err)
+		}
+	}
+
+	return nil
+}
@@ -10,9 +10,14 @@ CREATE TABLE IF NOT EXISTS weather (
     outtemp float4 NULL,
     windspeed float4 NULL,
     windspeed10 float4 NULL,
+    windgust float4 NULL,
     winddir float4 NULL,
     windchill float4 NULL,
     heatindex float4 NULL,
+    dewpoint float4 NULL,
+    wetbulb float4 NULL,
+    absolutehumidity float4 NULL,
+    pressuretrend float4 NULL,
     extratemp1 float4 NULL,
     extratemp2 float4 NULL,
     extratemp3 float4 NULL,
@@ -80,9 +85,21 @@ CREATE TABLE IF NOT EXISTS weather (
     forecasticon int NULL,
     forecastrule int NULL,
     sunrise TIMESTAMP WITH TIME ZONE NULL,
-    sunset TIMESTAMP WITH TIME ZONE NULL
+    sunset TIMESTAMP WITH TIME ZONE NULL,
+    preciptype text NULL
 );`
 
+// addColumnsSQL adds columns that were introduced after the weather table was first
+// created, so that existing databases pick them up
+var addColumnsSQL = []string{
+	`ALTER TABLE weather ADD COLUMN IF NOT EXISTS preciptype text NULL;`,
+	`ALTER TABLE weather ADD COLUMN IF NOT EXISTS windgust float4 NULL;`,
+	`ALTER TABLE weather ADD COLUMN IF NOT EXISTS dewpoint float4 NULL;`,
+	`ALTER TABLE weather ADD COLUMN IF NOT EXISTS wetbulb float4 NULL;`,
+	`ALTER TABLE weather ADD COLUMN IF NOT EXISTS absolutehumidity float4 NULL;`,
+	`ALTER TABLE weather ADD COLUMN IF NOT EXISTS pressuretrend float4 NULL;`,
+}
+
 const createExtensionSQL = `CREATE EXTENSION IF NOT EXISTS timescaledb;`
 
 const createHypertableSQL = `SELECT create_hypertable('weather', 'time', if_not_exists => true);`
@@ -129,6 +146,8 @@ BEGIN
 END;
 $$;`
 
+// createCircAvgFinalizerFunctionSQL is formatted with the minimum length of the mean
+// direction vector, between 0 and 1, below which the average direction is NULL
 const createCircAvgFinalizerFunctionSQL = `CREATE OR REPLACE FUNCTION circular_avg_final(state circular_avg_state)
 RETURNS real
 STRICT
@@ -141,8 +160,19 @@ DECLARE
     atan2_result real;
     final_result real;
 BEGIN
+    IF state.accum <= 0 THEN
+        RETURN NULL;
+    END IF;
+
     sin_avg := state.sin_sum / state.accum;
     cos_avg := state.cos_sum / state.accum;
+
+    -- When the directions cancel each other out, the mean vector is too short to
+    -- point anywhere meaningful
+    IF SQRT(sin_avg * sin_avg + cos_avg * cos_avg) < %v THEN
+        RETURN NULL;
+    END IF;
+
     atan2_result := ATAN2D(sin_avg, cos_avg);
     if atan2_result < 0 THEN
         final_result := atan2_result + 360;
@@ -165,6 +195,75 @@ const createCircAvgAggregateFunctionSQL = `CREATE OR REPLACE AGGREGATE circular_
     PARALLEL = SAFE
 );`
 
+// The speed-weighted circular average weights each wind direction by its wind speed so
+// that the meaningless directions reported during calm periods don't pull the average.
+// It shares its state type and combiner with circular_avg.  When the wind was calm for
+// the whole period, there is no average direction and it returns NULL.
+const createCircAvgWeightedStateFunctionSQL = `CREATE OR REPLACE FUNCTION circular_avg_weighted_state_accumulator(state circular_avg_state, reading real, weight real)
+RETURNS circular_avg_state
+STRICT
+IMMUTABLE
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    sin_sum real;
+    cos_sum real;
+BEGIN
+    sin_sum := state.sin_sum + weight * SIND(reading);
+    cos_sum := state.cos_sum + weight * COSD(reading);
+    RETURN ROW(sin_sum, cos_sum, state.accum + weight)::circular_avg_state;
+END;
+$$;
+`
+
+const createCircAvgWeightedFinalizerFunctionSQL = `CREATE OR REPLACE FUNCTION circular_avg_weighted_final(state circular_avg_state)
+RETURNS real
+STRICT
+IMMUTABLE
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    atan2_result real;
+BEGIN
+    IF state.accum <= 0 THEN
+        RETURN NULL;
+    END IF;
+
+    -- As with the unweighted average, winds that cancel each other out have no
+    -- meaningful mean direction
+    IF SQRT(state.sin_sum * state.sin_sum + state.cos_sum * state.cos_sum) / state.accum < %v THEN
+        RETURN NULL;
+    END IF;
+
+    atan2_result := ATAN2D(state.sin_sum, state.cos_sum);
+    IF atan2_result < 0 THEN
+        RETURN atan2_result + 360;
+    END IF;
+
+    RETURN atan2_result;
+END;
+$$;
+`
+
+const createCircAvgWeightedAggregateFunctionSQL = `CREATE OR REPLACE AGGREGATE circular_avg_weighted (real, real)
+(
+    SFUNC = circular_avg_weighted_state_accumulator,
+    STYPE = circular_avg_state,
+    COMBINEFUNC = circular_avg_state_combiner,
+    FINALFUNC = circular_avg_weighted_final,
+    INITCOND = '(0,0,0)',
+    PARALLEL = SAFE
+);`
+
+// Continuous aggregates can't be altered to add a column, so views created before a column
+// was added won't have it until they are re-created.  We check for those columns so that
+// we can tell the operator.
+const checkAggregateColumnSQL = `SELECT count(*) FROM information_schema.columns WHERE table_name = ? AND column_name = ?;`
+
+// Dropping a continuous aggregate also drops its refresh and retention policies, which
+// we add again at startup
+const dropAggregateViewSQL = `DROP MATERIALIZED VIEW IF EXISTS %v CASCADE;`
+
 const create1mViewSQL = `CREATE MATERIALIZED VIEW IF NOT EXISTS weather_1m
 WITH (timescaledb.continuous, timescaledb.materialized_only = false)
 AS
@@ -192,12 +291,17 @@ SELECT
     avg(solarwatts) as solarwatts,
     avg(solarjoules) as solarjoules,
     circular_avg(winddir) as winddir,
+    circular_avg_weighted(winddir, windspeed) as winddir_weighted,
     avg(windspeed) as windspeed,
     max(windspeed) as max_windspeed,
+    max(windgust) as max_windgust,
     avg(windchill) as windchill,
 	min(windchill) as min_windchill,
     avg(heatindex) as heatindex,
 	max(heatindex) as max_heatindex,
+    avg(dewpoint) as dewpoint,
+    avg(wetbulb) as wetbulb,
+    avg(absolutehumidity) as absolutehumidity,
     sum(rainincremental) as period_rain,
     avg(rainrate) as rainrate,
     max(rainrate) as max_rainrate,
@@ -237,12 +341,17 @@ SELECT
     avg(solarwatts) as solarwatts,
     avg(solarjoules) as solarjoules,
     circular_avg(winddir) as winddir,
+    circular_avg_weighted(winddir, windspeed) as winddir_weighted,
     avg(windspeed) as windspeed,
     max(windspeed) as max_windspeed,
+    max(windgust) as max_windgust,
     avg(windchill) as windchill,
 	min(windchill) as min_windchill,
     avg(heatindex) as heatindex,
 	max(heatindex) as max_heatindex,
+    avg(dewpoint) as dewpoint,
+    avg(wetbulb) as wetbulb,
+    avg(absolutehumidity) as absolutehumidity,
     sum(rainincremental) as period_rain,
     avg(rainrate) as rainrate,
     max(rainrate) as max_rainrate,
@@ -282,12 +391,17 @@ SELECT
     avg(solarwatts) as solarwatts,
     avg(solarjoules) as solarjoules,
     circular_avg(winddir) as winddir,
+    circular_avg_weighted(winddir, windspeed) as winddir_weighted,
     avg(windspeed) as windspeed,
     max(windspeed) as max_windspeed,
+    max(windgust) as max_windgust,
     avg(windchill) as windchill,
 	min(windchill) as min_windchill,
     avg(heatindex) as heatindex,
 	max(heatindex) as max_heatindex,
+    avg(dewpoint) as dewpoint,
+    avg(wetbulb) as wetbulb,
+    avg(absolutehumidity) as absolutehumidity,
     sum(rainincremental) as period_rain,
     avg(rainrate) as rainrate,
     max(rainrate) as max_rainrate,
@@ -327,12 +441,17 @@ SELECT
     avg(solarwatts) as solarwatts,
     avg(solarjoules) as solarjoules,
     circular_avg(winddir) as winddir,
+    circular_avg_weighted(winddir, windspeed) as winddir_weighted,
     avg(windspeed) as windspeed,
     max(windspeed) as max_windspeed,
+    max(windgust) as max_windgust,
     avg(windchill) as windchill,
 	min(windchill) as min_windchill,
     avg(heatindex) as heatindex,
 	max(heatindex) as max_heatindex,
+    avg(dewpoint) as dewpoint,
+    avg(wetbulb) as wetbulb,
+    avg(absolutehumidity) as absolutehumidity,
     sum(rainincremental) as period_rain,
     avg(rainrate) as rainrate,
     max(rainrate) as max_rainrate,
@@ -345,10 +464,10 @@ FROM
     weather
 GROUP BY bucket, stationname;`
 
-const addAggregationPolicy1mSQL = `SELECT add_continuous_aggregate_policy('weather_1m', '2 days', '1 minutes', '1 minutes', if_not_exists => true);`
-const addAggregationPolicy5mSQL = `SELECT add_continuous_aggregate_policy('weather_5m', '2 days', '5 minutes', '5 minutes', if_not_exists => true);`
-const addAggregationPolicy1hSQL = `SELECT add_continuous_aggregate_policy('weather_1h', '2 months', '1 hour', '1 hour', if_not_exists => true);`
-const addAggregationPolicy1dSQL = `SELECT add_continuous_aggregate_policy('weather_1d', '1 year', '1 day', '1 day', if_not_exists => true);`
+// add_continuous_aggregate_policy won't modify an existing policy, so we remove the policy
+// first to pick up any changes to its configuration
+const removeAggregationPolicySQL = `SELECT remove_continuous_aggregate_policy(?::regclass, if_exists => true);`
+const addAggregationPolicySQL = `SELECT add_continuous_aggregate_policy(?::regclass, start_offset => ?::interval, end_offset => ?::interval, schedule_interval => ?::interval, if_not_exists => true);`
 
 const addRetentionPolicy = `SELECT add_retention_policy('weather', INTERVAL '7 days', if_not_exists => true);`
 const addRetentionPolicy1m = `SELECT add_retention_policy('weather_1m', INTERVAL '1 month', if_not_exists => true);`
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSpillSkipsUnencodableReadings(t *testing.T) {
+	spillFile := filepath.Join(t.TempDir(), "spill")
+	start := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	s := &TimescaleDBStorage{spillFile: spillFile, retryQueueSize: 10}
+	s.queueForRetry(Reading{StationName: "test", Timestamp: start, OutTemp: 60})
+	s.queueForRetry(Reading{StationName: "test", Timestamp: start.Add(time.Minute), OutTemp: float32(math.NaN())})
+	s.queueForRetry(Reading{StationName: "test", Timestamp: start.Add(2 * time.Minute), OutTemp: 62})
+	s.spillRetryQueue()
+
+	loaded := &TimescaleDBStorage{spillFile: spillFile, retryQueueSize: 10}
+	if err := loaded.loadSpillFile(); err != nil {
+		t.Fatalf("loadSpillFile: %v", err)
+	}
+	if len(loaded.retryQueue) != 2 {
+		t.Fatalf("loaded %v readings, want the 2 that could be encoded", len(loaded.retryQueue))
+	}
+	if loaded.retryQueue[0].OutTemp != 60 || loaded.retryQueue[1].OutTemp != 62 {
+		t.Errorf("loaded temperatures %v and %v, want 60 and 62", loaded.retryQueue[0].OutTemp, loaded.retryQueue[1].OutTemp)
+	}
+}
+
+func TestLoadArraySpillFile(t *testing.T) {
+	spillFile := filepath.Join(t.TempDir(), "spill")
+
+	data, err := json.Marshal([]Reading{{StationName: "test", OutTemp: 60}, {StationName: "test", OutTemp: 61}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(spillFile, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &TimescaleDBStorage{spillFile: spillFile, retryQueueSize: 10}
+	if err := s.loadSpillFile(); err != nil {
+		t.Fatalf("loadSpillFile: %v", err)
+	}
+	if len(s.retryQueue) != 2 {
+		t.Errorf("loaded %v readings from a spill file written by an earlier version, want 2", len(s.retryQueue))
+	}
+}
+
+func TestQueuePendingReadings(t *testing.T) {
+	pending := make(chan Reading, 5)
+	for i := 0; i < 3; i++ {
+		pending <- Reading{StationName: "test", OutTemp: float32(i)}
+	}
+
+	s := &TimescaleDBStorage{retryQueueSize: 10}
+	s.queueForRetry(Reading{StationName: "test", OutTemp: -1})
+	s.queuePendingReadings(pending)
+
+	if len(s.retryQueue) != 4 {
+		t.Fatalf("retry queue holds %v readings, want 4", len(s.retryQueue))
+	}
+	for i, q := range s.retryQueue {
+		if q.OutTemp != float32(i-1) {
+			t.Errorf("retry queue position %v holds reading %v, want %v", i, q.OutTemp, i-1)
+		}
+	}
+}
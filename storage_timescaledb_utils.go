@@ -41,7 +41,7 @@ type FetchedBucketReading struct {
 	MaxOutHumidity        float32    `gorm:"column:max_outhumidity"`
 	WindSpeed             float32    `gorm:"column:windspeed"`
 	MaxWindSpeed          float32    `gorm:"column:max_windspeed"`
-	WindDir               float32    `gorm:"column:winddir"`
+	WindDir               *float32   `gorm:"column:winddir"`
 	WindChill             float32    `gorm:"column:windchill"`
 	MinWindChill          float32    `gorm:"column:min_windchill"`
 	HeatIndex             float32    `gorm:"column:heatindex"`
@@ -98,6 +98,15 @@ func (t *TimescaleDBClient) connectToTimescaleDB(s StorageConfig) error {
 	return nil
 }
 
+// close closes the client's connection to TimescaleDB
+func (t *TimescaleDBClient) close() error {
+	sqlDB, err := t.db.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 func (p *TimescaleDBClient) getReadingsFromTimescaleDB(pullFromDevice string) (FetchedBucketReading, error) {
 	var br FetchedBucketReading
 
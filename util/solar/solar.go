@@ -0,0 +1,234 @@
+// Package solar calculates the position of the sun and the times of sunrise, sunset, and
+// twilight for a location on Earth.
+//
+// The calculations follow NOAA's solar calculator
+// (https://gml.noaa.gov/grad/solcalc/calcdetails.html), which is based on Jean Meeus'
+// Astronomical Algorithms.  Times are accurate to about a minute for latitudes between
+// +/- 72°, and positions to a small fraction of a degree.
+package solar
+
+import (
+	"math"
+	"time"
+)
+
+// Zenith angles, in degrees, that mark the sun's rising and setting and the ends of the
+// three twilights.  Sunrise and sunset allow for the sun's radius and for atmospheric
+// refraction at the horizon.
+const (
+	zenithSunrise      = 90.833
+	zenithCivil        = 96.0
+	zenithNautical     = 102.0
+	zenithAstronomical = 108.0
+)
+
+// Times holds the times of the sun's daily events.  Dawn is the start of a twilight in
+// the morning and dusk is its end in the evening.  An event that doesn't happen on the
+// day in question (e.g. sunset during the polar summer) has a zero time.
+type Times struct {
+	SolarNoon        time.Time
+	Sunrise          time.Time
+	Sunset           time.Time
+	CivilDawn        time.Time
+	CivilDusk        time.Time
+	NauticalDawn     time.Time
+	NauticalDusk     time.Time
+	AstronomicalDawn time.Time
+	AstronomicalDusk time.Time
+}
+
+// SunTimes returns the times of the sun's events on the day that contains t, in t's
+// location.  lat and lon are in degrees, with north and east positive.  alt is the
+// observer's height above the surrounding terrain in meters, which lets them see the sun
+// a little before it rises over the horizon.  The returned times are in t's location.
+func SunTimes(lat, lon, alt float64, t time.Time) Times {
+	loc := t.Location()
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+
+	// Start from local noon, which is always close to solar noon
+	noon := solarNoon(lon, midnight.Add(12*time.Hour))
+	noon = solarNoon(lon, noon)
+
+	// The horizon is lower for an observer above the terrain
+	dip := 0.0
+	if alt > 0 {
+		dip = 0.0347 * math.Sqrt(alt)
+	}
+
+	st := Times{SolarNoon: noon.In(loc)}
+	st.Sunrise, st.Sunset = riseAndSet(lat, lon, noon, zenithSunrise+dip)
+	st.CivilDawn, st.CivilDusk = riseAndSet(lat, lon, noon, zenithCivil)
+	st.NauticalDawn, st.NauticalDusk = riseAndSet(lat, lon, noon, zenithNautical)
+	st.AstronomicalDawn, st.AstronomicalDusk = riseAndSet(lat, lon, noon, zenithAstronomical)
+
+	for _, et := range []*time.Time{&st.Sunrise, &st.Sunset, &st.CivilDawn, &st.CivilDusk,
+		&st.NauticalDawn, &st.NauticalDusk, &st.AstronomicalDawn, &st.AstronomicalDusk} {
+		if !et.IsZero() {
+			*et = et.In(loc)
+		}
+	}
+
+	return st
+}
+
+// Elevation returns the sun's apparent elevation above the horizon at time t, in degrees,
+// corrected for atmospheric refraction.  It's negative when the sun is below the horizon.
+func Elevation(lat, lon float64, t time.Time) float64 {
+	elevation, _ := position(lat, lon, t)
+	return elevation
+}
+
+// Azimuth returns the sun's azimuth at time t, in degrees clockwise from true north
+func Azimuth(lat, lon float64, t time.Time) float64 {
+	_, azimuth := position(lat, lon, t)
+	return azimuth
+}
+
+// position calculates the sun's apparent elevation and azimuth
+func position(lat, lon float64, t time.Time) (float64, float64) {
+	decl, eqTime := sunDeclinationAndEquationOfTime(t)
+
+	utc := t.UTC()
+	minutes := float64(utc.Hour()*60+utc.Minute()) + float64(utc.Second())/60 + float64(utc.Nanosecond())/6e10
+
+	trueSolarTime := math.Mod(minutes+eqTime+4*lon, 1440)
+	if trueSolarTime < 0 {
+		trueSolarTime += 1440
+	}
+
+	hourAngle := trueSolarTime/4 - 180
+
+	cosZenith := sin(lat)*sin(decl) + cos(lat)*cos(decl)*cos(hourAngle)
+	zenith := acos(clamp(cosZenith))
+	elevation := 90 - zenith
+
+	var azimuth float64
+	if denom := cos(lat) * sin(zenith); math.Abs(denom) > 1e-9 {
+		azimuth = acos(clamp((sin(lat)*cos(zenith) - sin(decl)) / denom))
+		if hourAngle > 0 {
+			azimuth = math.Mod(azimuth+180, 360)
+		} else {
+			azimuth = math.Mod(540-azimuth, 360)
+		}
+	} else if lat > 0 {
+		// The sun is directly overhead or we're at a pole
+		azimuth = 180
+	}
+
+	return elevation + refraction(elevation), azimuth
+}
+
+// refraction returns NOAA's approximation of atmospheric refraction, in degrees, for a
+// body at the given true elevation
+func refraction(elevation float64) float64 {
+	te := math.Tan(elevation * math.Pi / 180)
+
+	var arcsec float64
+	switch {
+	case elevation > 85:
+		return 0
+	case elevation > 5:
+		arcsec = 58.1/te - 0.07/(te*te*te) + 0.000086/math.Pow(te, 5)
+	case elevation > -0.575:
+		arcsec = 1735 + elevation*(-518.2+elevation*(103.4+elevation*(-12.79+elevation*0.711)))
+	default:
+		arcsec = -20.772 / te
+	}
+
+	return arcsec / 3600
+}
+
+// solarNoon returns the time of solar noon nearest to t
+func solarNoon(lon float64, t time.Time) time.Time {
+	_, eqTime := sunDeclinationAndEquationOfTime(t)
+	utcMidnight := time.Date(t.UTC().Year(), t.UTC().Month(), t.UTC().Day(), 0, 0, 0, 0, time.UTC)
+	return utcMidnight.Add(minutes(720 - 4*lon - eqTime))
+}
+
+// riseAndSet returns the times before and after solar noon when the sun is at zenith
+// degrees from straight up.  Each time is refined once using the sun's position at the
+// first estimate.  If the sun never reaches zenith that day, both times are zero.
+func riseAndSet(lat, lon float64, noon time.Time, zenith float64) (time.Time, time.Time) {
+	event := func(sign float64) time.Time {
+		t := noon
+		for i := 0; i < 2; i++ {
+			ha, ok := hourAngle(lat, zenith, t)
+			if !ok {
+				return time.Time{}
+			}
+			t = solarNoon(lon, t).Add(minutes(sign * 4 * ha))
+		}
+		return t
+	}
+
+	rise := event(-1)
+	set := event(1)
+	if rise.IsZero() || set.IsZero() {
+		return time.Time{}, time.Time{}
+	}
+
+	return rise, set
+}
+
+// hourAngle returns the hour angle, in degrees, at which the sun is at zenith degrees.
+// ok is false if the sun never gets that high or that low.
+func hourAngle(lat, zenith float64, t time.Time) (float64, bool) {
+	decl, _ := sunDeclinationAndEquationOfTime(t)
+
+	cosHA := cos(zenith)/(cos(lat)*cos(decl)) - tan(lat)*tan(decl)
+	if cosHA < -1 || cosHA > 1 || math.IsNaN(cosHA) {
+		return 0, false
+	}
+
+	return acos(cosHA), true
+}
+
+// sunDeclinationAndEquationOfTime returns the sun's declination in degrees and the
+// equation of time in minutes at time t
+func sunDeclinationAndEquationOfTime(t time.Time) (float64, float64) {
+	// Julian centuries since J2000.0
+	jd := float64(t.UTC().UnixNano())/86400e9 + 2440587.5
+	jc := (jd - 2451545) / 36525
+
+	meanLong := math.Mod(280.46646+jc*(36000.76983+jc*0.0003032), 360)
+	meanAnom := 357.52911 + jc*(35999.05029-0.0001537*jc)
+	eccent := 0.016708634 - jc*(0.000042037+0.0000001267*jc)
+
+	center := sin(meanAnom)*(1.914602-jc*(0.004817+0.000014*jc)) +
+		sin(2*meanAnom)*(0.019993-0.000101*jc) +
+		sin(3*meanAnom)*0.000289
+
+	trueLong := meanLong + center
+	omega := 125.04 - 1934.136*jc
+	appLong := trueLong - 0.00569 - 0.00478*sin(omega)
+
+	meanObliq := 23 + (26+(21.448-jc*(46.815+jc*(0.00059-jc*0.001813)))/60)/60
+	obliq := meanObliq + 0.00256*cos(omega)
+
+	decl := asin(sin(obliq) * sin(appLong))
+
+	y := tan(obliq/2) * tan(obliq/2)
+	eqTime := 4 * (180 / math.Pi) * (y*sin(2*meanLong) -
+		2*eccent*sin(meanAnom) +
+		4*eccent*y*sin(meanAnom)*cos(2*meanLong) -
+		0.5*y*y*sin(4*meanLong) -
+		1.25*eccent*eccent*sin(2*meanAnom))
+
+	return decl, eqTime
+}
+
+func minutes(m float64) time.Duration {
+	return time.Duration(m * float64(time.Minute))
+}
+
+func clamp(x float64) float64 {
+	return math.Max(-1, math.Min(1, x))
+}
+
+// Trigonometry in degrees
+
+func sin(deg float64) float64 { return math.Sin(deg * math.Pi / 180) }
+func cos(deg float64) float64 { return math.Cos(deg * math.Pi / 180) }
+func tan(deg float64) float64 { return math.Tan(deg * math.Pi / 180) }
+func asin(x float64) float64  { return math.Asin(x) * 180 / math.Pi }
+func acos(x float64) float64  { return math.Acos(x) * 180 / math.Pi }
@@ -27,17 +27,24 @@ type WeatherStation interface {
 // implementation, you should ideally use one of the existing Reading struct members.
 // If you can't find what you need in here, you can add a new member to the struct.
 type Reading struct {
-	Timestamp             time.Time `gorm:"column:time"`
-	StationName           string    `gorm:"column:stationname"`
-	Barometer             float32   `gorm:"column:barometer"`
-	InTemp                float32   `gorm:"column:intemp"`
-	InHumidity            float32   `gorm:"column:inhumidity"`
-	OutTemp               float32   `gorm:"column:outtemp"`
-	WindSpeed             float32   `gorm:"column:windspeed"`
-	WindSpeed10           float32   `gorm:"column:windspeed10"`
-	WindDir               float32   `gorm:"column:winddir"`
-	WindChill             float32   `gorm:"column:windchill"`
-	HeatIndex             float32   `gorm:"column:heatindex"`
+	Timestamp        time.Time `gorm:"column:time"`
+	StationName      string    `gorm:"column:stationname"`
+	Barometer        float32   `gorm:"column:barometer"`
+	InTemp           float32   `gorm:"column:intemp"`
+	InHumidity       float32   `gorm:"column:inhumidity"`
+	OutTemp          float32   `gorm:"column:outtemp"`
+	WindSpeed        float32   `gorm:"column:windspeed"`
+	WindSpeed10      float32   `gorm:"column:windspeed10"`
+	WindGust         float32   `gorm:"column:windgust"`
+	WindDir          float32   `gorm:"column:winddir"`
+	WindChill        float32   `gorm:"column:windchill"`
+	HeatIndex        float32   `gorm:"column:heatindex"`
+	DewPoint         float32   `gorm:"column:dewpoint"`
+	WetBulb          float32   `gorm:"column:wetbulb"`
+	AbsoluteHumidity float32   `gorm:"column:absolutehumidity"`
+	// PressureTrend is the change in barometer over the last three hours.  It's nil
+	// until we have three hours of readings from the station.
+	PressureTrend         *float32  `gorm:"column:pressuretrend"`
 	ExtraTemp1            float32   `gorm:"column:extratemp1"`
 	ExtraTemp2            float32   `gorm:"column:extratemp2"`
 	ExtraTemp3            float32   `gorm:"column:extratemp3"`
@@ -106,6 +113,7 @@ type Reading struct {
 	ForecastRule          uint8     `gorm:"column:forecastrule"`
 	Sunrise               time.Time `gorm:"column:sunrise"`
 	Sunset                time.Time `gorm:"column:sunset"`
+	PrecipType            string    `gorm:"column:preciptype"`
 }
 
 // NewWeatherStationManager creats a WeatherStationManager object, populated with all configured
@@ -114,6 +122,37 @@ func NewWeatherStationManager(ctx context.Context, wg *sync.WaitGroup, c *Config
 	wsm := WeatherStationManager{}
 
 	for _, s := range c.Devices {
+		err := validateDerivedFields(&s.DerivedFields)
+		if err != nil {
+			return &wsm, fmt.Errorf("invalid derived-fields for station %v: %v", s.Name, err)
+		}
+
+		if s.TimestampSource == "" {
+			s.TimestampSource = defaultTimestampSource
+		}
+
+		switch s.TimestampSource {
+		case "server":
+		case "station":
+			if s.Type == "davis" {
+				log.Infof("Davis LOOP packets carry no timestamp; station [%v] will use server time", s.Name)
+			}
+		default:
+			return &wsm, fmt.Errorf("invalid timestamp-source %q for station %v: must be server or station", s.TimestampSource, s.Name)
+		}
+
+		if _, ok := windSpeedToMPH[s.WindInputUnit]; !ok {
+			return &wsm, fmt.Errorf("invalid wind-input-unit %q for station %v: must be mph, mps, kph, or knots", s.WindInputUnit, s.Name)
+		}
+
+		if _, ok := temperatureToF[s.TemperatureInputUnit]; !ok {
+			return &wsm, fmt.Errorf("invalid temperature-input-unit %q for station %v: must be f or c", s.TemperatureInputUnit, s.Name)
+		}
+
+		if s.Type == "davis" && (s.WindInputUnit != "" || s.TemperatureInputUnit != "") {
+			log.Infof("Davis LOOP packets are always in imperial units; input units for station [%v] will be ignored", s.Name)
+		}
+
 		switch s.Type {
 		case "davis":
 			log.Infof("Initializing Davis weather station [%v]", s.Name)
@@ -137,6 +176,38 @@ func NewWeatherStationManager(ctx context.Context, wg *sync.WaitGroup, c *Config
 	return &wsm, nil
 }
 
+// defaultTimestampSource is used for devices that don't set timestamp-source.  Readings
+// are stamped with the server's time unless the device asks for the station's.
+const defaultTimestampSource = "server"
+
+// readingTimestamp picks the timestamp for a new reading.  The station's time is used if
+// the device is configured with timestamp-source: station and the station supplied one.
+// Otherwise, the reading is stamped with the server's time of arrival.
+func readingTimestamp(c DeviceConfig, stationTime time.Time) time.Time {
+	if c.TimestampSource == "station" && !stationTime.IsZero() {
+		return stationTime
+	}
+	return time.Now()
+}
+
+// windSpeedToMPH converts wind speeds from a station's configured wind-input-unit to mph,
+// which is what we store.  An empty unit means the station already reports mph.
+var windSpeedToMPH = map[string]func(float32) float32{
+	"":      func(v float32) float32 { return v },
+	"mph":   func(v float32) float32 { return v },
+	"mps":   func(v float32) float32 { return v * 2.236936 },
+	"kph":   func(v float32) float32 { return v * 0.621371 },
+	"knots": func(v float32) float32 { return v * 1.150779 },
+}
+
+// temperatureToF converts temperatures from a station's configured temperature-input-unit
+// to degrees Fahrenheit.  An empty unit means the station already reports Fahrenheit.
+var temperatureToF = map[string]func(float32) float32{
+	"":  func(v float32) float32 { return v },
+	"f": func(v float32) float32 { return v },
+	"c": func(v float32) float32 { return v*9/5 + 32 },
+}
+
 func (wsm *WeatherStationManager) StartWeatherStations() error {
 	var err error
 
@@ -151,6 +222,146 @@ func (wsm *WeatherStationManager) StartWeatherStations() error {
 	return nil
 }
 
+// derivedTemperatureFields are the columns that may be used as the temperature input to
+// the derived calculations
+var derivedTemperatureFields = map[string]func(*Reading) float32{
+	"outtemp":    func(r *Reading) float32 { return r.OutTemp },
+	"intemp":     func(r *Reading) float32 { return r.InTemp },
+	"extratemp1": func(r *Reading) float32 { return r.ExtraTemp1 },
+	"extratemp2": func(r *Reading) float32 { return r.ExtraTemp2 },
+	"extratemp3": func(r *Reading) float32 { return r.ExtraTemp3 },
+	"extratemp4": func(r *Reading) float32 { return r.ExtraTemp4 },
+	"extratemp5": func(r *Reading) float32 { return r.ExtraTemp5 },
+	"extratemp6": func(r *Reading) float32 { return r.ExtraTemp6 },
+	"extratemp7": func(r *Reading) float32 { return r.ExtraTemp7 },
+}
+
+// derivedHumidityFields are the columns that may be used as the humidity input to the
+// derived calculations
+var derivedHumidityFields = map[string]func(*Reading) float32{
+	"outhumidity":    func(r *Reading) float32 { return r.OutHumidity },
+	"inhumidity":     func(r *Reading) float32 { return r.InHumidity },
+	"extrahumidity1": func(r *Reading) float32 { return r.ExtraHumidity1 },
+	"extrahumidity2": func(r *Reading) float32 { return r.ExtraHumidity2 },
+	"extrahumidity3": func(r *Reading) float32 { return r.ExtraHumidity3 },
+	"extrahumidity4": func(r *Reading) float32 { return r.ExtraHumidity4 },
+	"extrahumidity5": func(r *Reading) float32 { return r.ExtraHumidity5 },
+	"extrahumidity6": func(r *Reading) float32 { return r.ExtraHumidity6 },
+	"extrahumidity7": func(r *Reading) float32 { return r.ExtraHumidity7 },
+}
+
+const (
+	defaultSnowMaxWetBulb = 33.0
+	defaultRainMinWetBulb = 35.0
+)
+
+// derivedFieldEnabled returns true unless the derived field has been explicitly disabled
+func derivedFieldEnabled(setting *bool) bool {
+	return setting == nil || *setting
+}
+
+// derivedInputs returns the temperature and humidity that feed a reading's derived
+// calculations
+func derivedInputs(r *Reading, c DerivedFieldsConfig) (float32, float32) {
+	temp := r.OutTemp
+	if f, ok := derivedTemperatureFields[c.TemperatureField]; ok {
+		temp = f(r)
+	}
+
+	humidity := r.OutHumidity
+	if f, ok := derivedHumidityFields[c.HumidityField]; ok {
+		humidity = f(r)
+	}
+
+	return temp, humidity
+}
+
+// calcDerivedFields calculates the enabled derived values for a reading from the
+// values reported by the station.  Precipitation type depends on the rain rate, which
+// ingest may recalculate, so it's left to the ReadingProcessor.
+func calcDerivedFields(r *Reading, c DerivedFieldsConfig) {
+	temp, humidity := derivedInputs(r, c)
+
+	if derivedFieldEnabled(c.WindChill) {
+		r.WindChill = finiteDerivedValue(r, "wind chill", calcWindChill(temp, r.WindSpeed), temp, temp, humidity)
+	}
+
+	if derivedFieldEnabled(c.HeatIndex) {
+		r.HeatIndex = finiteDerivedValue(r, "heat index", calcHeatIndex(temp, humidity), temp, temp, humidity)
+	}
+
+	if derivedFieldEnabled(c.DewPoint) {
+		r.DewPoint = finiteDerivedValue(r, "dew point", calcDewPoint(temp, humidity), temp, temp, humidity)
+	}
+
+	if derivedFieldEnabled(c.WetBulb) {
+		r.WetBulb = finiteDerivedValue(r, "wet-bulb temperature", calcWetBulb(temp, humidity), temp, temp, humidity)
+	}
+
+	if derivedFieldEnabled(c.AbsoluteHumidity) {
+		r.AbsoluteHumidity = finiteDerivedValue(r, "absolute humidity", calcAbsoluteHumidity(temp, humidity), 0, temp, humidity)
+	}
+}
+
+// finiteDerivedValue guards against storing a NaN or Inf from a derived calculation, which
+// can happen when a sensor reports something out of range.  A non-finite result is logged
+// and replaced with fallback.  For the temperatures, that's the input temperature, which is
+// what wind chill and heat index fall back to when they don't apply.  If the fallback isn't
+// finite either, zero is used.
+func finiteDerivedValue(r *Reading, field string, v float32, fallback float32, temp float32, humidity float32) float32 {
+	if isFinite(v) {
+		return v
+	}
+
+	if !isFinite(fallback) {
+		fallback = 0
+	}
+
+	log.Warnf("calculated %v for station %v is %v (temperature %v, humidity %v, wind speed %v); storing %v instead",
+		field, r.StationName, v, temp, humidity, r.WindSpeed, fallback)
+
+	return fallback
+}
+
+func isFinite(v float32) bool {
+	return !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+}
+
+// validateDerivedFields checks a station's derived field configuration for consistency and
+// fills in defaults
+func validateDerivedFields(c *DerivedFieldsConfig) error {
+	if c.TemperatureField == "" {
+		c.TemperatureField = "outtemp"
+	}
+
+	if _, ok := derivedTemperatureFields[c.TemperatureField]; !ok {
+		return fmt.Errorf("temperature-field %q is not a temperature column", c.TemperatureField)
+	}
+
+	if c.HumidityField == "" {
+		c.HumidityField = "outhumidity"
+	}
+
+	if _, ok := derivedHumidityFields[c.HumidityField]; !ok {
+		return fmt.Errorf("humidity-field %q is not a humidity column", c.HumidityField)
+	}
+
+	if c.PrecipTypeThresholds.SnowMaxWetBulb == 0 {
+		c.PrecipTypeThresholds.SnowMaxWetBulb = defaultSnowMaxWetBulb
+	}
+
+	if c.PrecipTypeThresholds.RainMinWetBulb == 0 {
+		c.PrecipTypeThresholds.RainMinWetBulb = defaultRainMinWetBulb
+	}
+
+	if c.PrecipTypeThresholds.SnowMaxWetBulb >= c.PrecipTypeThresholds.RainMinWetBulb {
+		return fmt.Errorf("precip-type-thresholds: snow-max-wet-bulb (%v) must be lower than rain-min-wet-bulb (%v)",
+			c.PrecipTypeThresholds.SnowMaxWetBulb, c.PrecipTypeThresholds.RainMinWetBulb)
+	}
+
+	return nil
+}
+
 func calcWindChill(temp float32, windspeed float32) float32 {
 	// For wind speeds < 3 or temps > 50, wind chill is just the current temperature
 	if (temp > 50) || (windspeed < 3) {
@@ -211,3 +422,178 @@ func calcHeatIndex(temp float32, humidity float32) float32 {
 	}
 	return temp
 }
+
+// calcWetBulb calculates the wet-bulb temperature (°F) from the air temperature (°F) and
+// relative humidity, using Stull's empirical formula.  The formula is accurate to within
+// about 1° C for relative humidity between 5% and 99% and temperatures between -20° C and 50° C.
+// Outside that range, in cold, dry air, it can put the wet-bulb temperature above the air
+// temperature, which is impossible, so the result is capped at the air temperature.
+func calcWetBulb(temp float32, humidity float32) float32 {
+	t := (float64(temp) - 32) * 5 / 9
+	rh := float64(humidity)
+
+	tw := t*math.Atan(0.151977*math.Sqrt(rh+8.313659)) +
+		math.Atan(t+rh) - math.Atan(rh-1.676331) +
+		0.00391838*math.Pow(rh, 1.5)*math.Atan(0.023101*rh) -
+		4.686035
+
+	return float32(math.Min(tw, t)*9/5 + 32)
+}
+
+// calcDewPoint calculates the dew point (°F) from the air temperature (°F) and relative
+// humidity, using the Magnus formula with Alduchov and Eskridge's coefficients, which are
+// accurate to within about 0.4° C between -40° C and 50° C.  The dew point is undefined at
+// 0% humidity, so humidity is clamped to at least 1%.  Below freezing, this is the dew
+// point over water rather than the frost point, as is usual in weather reports.
+func calcDewPoint(temp float32, humidity float32) float32 {
+	t := (float64(temp) - 32) * 5 / 9
+	rh := math.Max(1, math.Min(100, float64(humidity)))
+
+	gamma := math.Log(rh/100) + 17.625*t/(243.04+t)
+	dp := 243.04 * gamma / (17.625 - gamma)
+
+	return float32(dp*9/5 + 32)
+}
+
+// calcAbsoluteHumidity calculates the mass of water vapor in the air (g/m³) from the air
+// temperature (°F) and relative humidity
+func calcAbsoluteHumidity(temp float32, humidity float32) float32 {
+	t := (float64(temp) - 32) * 5 / 9
+	rh := math.Max(0, math.Min(100, float64(humidity)))
+
+	// Saturation vapor pressure (hPa) from the Magnus formula, scaled by the relative
+	// humidity and converted to vapor density with the ideal gas law
+	es := 6.1094 * math.Exp(17.625*t/(243.04+t))
+	return float32(216.7 * (rh / 100 * es) / (273.15 + t))
+}
+
+// calcPrecipType infers the type of precipitation (rain, snow, or mix) from the wet-bulb
+// temperature.  If no precipitation is falling, an empty string is returned.  Sleet and
+// freezing rain depend on the temperature profile aloft and can't be told apart from
+// surface readings alone, so they are reported as a mix or rain.
+func calcPrecipType(r *Reading, temp float32, humidity float32, t PrecipTypeThresholds) string {
+	if r.RainRate <= 0 && r.RainIncremental <= 0 {
+		return ""
+	}
+
+	wetBulb := calcWetBulb(temp, humidity)
+	if !isFinite(wetBulb) {
+		log.Warnf("calculated wet-bulb temperature for station %v is %v (temperature %v, humidity %v); not classifying precipitation",
+			r.StationName, wetBulb, temp, humidity)
+		return ""
+	}
+
+	switch {
+	case wetBulb <= t.SnowMaxWetBulb:
+		return "snow"
+	case wetBulb >= t.RainMinWetBulb:
+		return "rain"
+	default:
+		return "mix"
+	}
+}
+
+const (
+	// pressureSteadyThreshold is the largest change in barometric pressure (inHg) over
+	// three hours that we still consider steady
+	pressureSteadyThreshold = 0.02
+	// pressureHalfSteadyThreshold is the same, but for each 90-minute half of the period
+	pressureHalfSteadyThreshold = 0.01
+	// pressureRapidThreshold is the smallest change in barometric pressure (inHg) over
+	// three hours that we consider rapid.  This matches Davis consoles.
+	pressureRapidThreshold = 0.06
+)
+
+// pressureTrendLabel describes a three-hour change in barometric pressure (inHg)
+func pressureTrendLabel(change float32) string {
+	switch {
+	case change >= pressureRapidThreshold:
+		return "rising rapidly"
+	case change > pressureSteadyThreshold:
+		return "rising slowly"
+	case change <= -pressureRapidThreshold:
+		return "falling rapidly"
+	case change < -pressureSteadyThreshold:
+		return "falling slowly"
+	default:
+		return "steady"
+	}
+}
+
+// calcPressureTendency returns the WMO pressure tendency characteristic (code table 0200)
+// for the three hours of barometer readings in pressures, oldest first, along with a
+// simple arrow for displays.  The shape of the curve is judged by comparing the change
+// over the first half of the period to the change over the second half.  ok is false if
+// there aren't enough readings to tell.
+func calcPressureTendency(pressures []float32) (code int, arrow string, ok bool) {
+	if len(pressures) < 3 {
+		return 0, "", false
+	}
+
+	first := pressures[0]
+	middle := pressures[len(pressures)/2]
+	last := pressures[len(pressures)-1]
+
+	d1 := middle - first
+	d2 := last - middle
+	total := last - first
+
+	direction := func(d float32) int {
+		switch {
+		case d > pressureHalfSteadyThreshold:
+			return 1
+		case d < -pressureHalfSteadyThreshold:
+			return -1
+		default:
+			return 0
+		}
+	}
+	dir1, dir2 := direction(d1), direction(d2)
+
+	switch {
+	case total > pressureSteadyThreshold:
+		arrow = "↑"
+		switch {
+		case dir1 > 0 && dir2 < 0:
+			code = 0
+		case dir1 > 0 && dir2 == 0:
+			code = 1
+		case dir1 <= 0 && dir2 > 0:
+			code = 3
+		case d2 < d1-pressureHalfSteadyThreshold:
+			code = 1
+		case d2 > d1+pressureHalfSteadyThreshold:
+			code = 3
+		default:
+			code = 2
+		}
+	case total < -pressureSteadyThreshold:
+		arrow = "↓"
+		switch {
+		case dir1 < 0 && dir2 > 0:
+			code = 5
+		case dir1 < 0 && dir2 == 0:
+			code = 6
+		case dir1 >= 0 && dir2 < 0:
+			code = 8
+		case d2 > d1+pressureHalfSteadyThreshold:
+			code = 6
+		case d2 < d1-pressureHalfSteadyThreshold:
+			code = 8
+		default:
+			code = 7
+		}
+	default:
+		arrow = "→"
+		switch {
+		case dir1 > 0 && dir2 < 0:
+			code = 0
+		case dir1 < 0 && dir2 > 0:
+			code = 5
+		default:
+			code = 4
+		}
+	}
+
+	return code, arrow, true
+}
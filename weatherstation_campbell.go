@@ -41,6 +41,9 @@ type CampbellPacket struct {
 	RainIncremental       float32 `json:"rain_in,omitempty"`
 	WindSpeed             float32 `json:"wind_s,omitempty"`
 	WindDir               uint16  `json:"wind_d,omitempty"`
+	// Timestamp is the observation time in milliseconds since the Unix epoch.  It's only
+	// used as the reading time when the device sets timestamp-source: station.
+	Timestamp int64 `json:"ts,omitempty"`
 }
 
 func NewCampbellScientificWeatherStation(ctx context.Context, wg *sync.WaitGroup, c DeviceConfig, distributor chan Reading, logger *zap.SugaredLogger) (*CampbellScientificWeatherStation, error) {
@@ -153,28 +156,41 @@ func (w *CampbellScientificWeatherStation) ParseCampbellScientificPackets() erro
 			log.Info("cancellation request recieved.  Cancelling ParseCampbellPackets()")
 			return nil
 		default:
+			// Reset the packet so that fields missing from this line don't carry over
+			// from the previous one
+			cp = CampbellPacket{}
 			err := json.Unmarshal(scanner.Bytes(), &cp)
 			if err != nil {
 				return fmt.Errorf("error unmarshalling JSON: %v", err)
 			}
 
+			var stationTime time.Time
+			if cp.Timestamp != 0 {
+				stationTime = time.UnixMilli(cp.Timestamp)
+			}
+
+			// The logger program may report in other units, so we convert to the
+			// imperial units that we store
+			toMPH := windSpeedToMPH[w.Config.WindInputUnit]
+			toF := temperatureToF[w.Config.TemperatureInputUnit]
+
 			r := Reading{
-				Timestamp:             time.Now(),
+				Timestamp:             readingTimestamp(w.Config, stationTime),
 				StationName:           w.Config.Name,
 				StationBatteryVoltage: cp.StationBatteryVoltage,
-				OutTemp:               cp.OutTemp,
+				OutTemp:               toF(cp.OutTemp),
 				OutHumidity:           cp.OutHumidity,
 				Barometer:             cp.Barometer,
-				ExtraTemp1:            cp.ExtraTemp1,
+				ExtraTemp1:            toF(cp.ExtraTemp1),
 				SolarWatts:            cp.SolarWatts,
 				SolarJoules:           cp.SolarJoules,
 				RainIncremental:       cp.RainIncremental,
-				WindSpeed:             cp.WindSpeed,
+				WindSpeed:             toMPH(cp.WindSpeed),
 				WindDir:               float32(cp.WindDir),
-				WindChill:             calcWindChill(cp.OutTemp, cp.WindSpeed),
-				HeatIndex:             calcHeatIndex(cp.OutTemp, cp.OutHumidity),
 			}
 
+			calcDerivedFields(&r, w.Config.DerivedFields)
+
 			// Send the reading to the distributor
 			w.ReadingDistributor <- r
 		}
@@ -134,7 +134,14 @@ type LoopPacketWithTrend struct {
 	Trend int8
 }
 
+// defaultDavisPort is the port that WeatherLinkIP data loggers listen on
+const defaultDavisPort = "22222"
+
 func NewDavisWeatherStation(ctx context.Context, wg *sync.WaitGroup, c DeviceConfig, distributor chan Reading, logger *zap.SugaredLogger) (*DavisWeatherStation, error) {
+	if c.Hostname != "" && c.Port == "" {
+		c.Port = defaultDavisPort
+	}
+
 	d := DavisWeatherStation{
 		ctx:                ctx,
 		wg:                 wg,
@@ -151,7 +158,7 @@ func NewDavisWeatherStation(ctx context.Context, wg *sync.WaitGroup, c DeviceCon
 		log.Info("Configuring Davis station via serial port...")
 	}
 
-	if c.Hostname != "" && c.Port == "" {
+	if c.Hostname != "" {
 		log.Info("Configuring Davis station via TCP/IP")
 	}
 
@@ -611,10 +618,13 @@ func (w *DavisWeatherStation) GetDavisLoopPackets(n int) error {
 
 				r := convValues(unpacked)
 
-				// Set the timestamp on our reading to the current system time
+				// LOOP packets carry no timestamp, so we always use the current system time
+				// regardless of timestamp-source
 				r.Timestamp = time.Now()
 				r.StationName = w.Config.Name
 
+				calcDerivedFields(&r, w.Config.DerivedFields)
+
 				log.Debugf("Packet recieved: %+v", r)
 
 				w.ReadingDistributor <- r
@@ -773,8 +783,6 @@ func convValues(lp *LoopPacketWithTrend) Reading {
 		ForecastRule:       lp.ForecastRule,
 		Sunrise:            convSunTime(lp.Sunrise),
 		Sunset:             convSunTime(lp.Sunset),
-		WindChill:          calcWindChill(convBigVal10(lp.OutTemp), convLittleVal(lp.WindSpeed)),
-		HeatIndex:          calcHeatIndex(convBigVal10(lp.OutTemp), convLittleVal(lp.OutHumidity)),
 	}
 
 	return r
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalcPrecipType(t *testing.T) {
+	thresholds := PrecipTypeThresholds{SnowMaxWetBulb: defaultSnowMaxWetBulb, RainMinWetBulb: defaultRainMinWetBulb}
+
+	tests := []struct {
+		name        string
+		temp        float32
+		humidity    float32
+		rainRate    float32
+		incremental float32
+		want        string
+	}{
+		{"rain", 50, 80, 0.1, 0, "rain"},
+		{"snow", 28, 90, 0.1, 0, "snow"},
+		// Evaporation cools dry air enough for snow above freezing
+		{"snow in dry air above freezing", 38, 60, 0.1, 0, "snow"},
+		{"sleet or mix", 35, 95, 0.1, 0, "mix"},
+		{"incremental rain without a rate", 50, 80, 0, 0.01, "rain"},
+		{"none", 50, 80, 0, 0, ""},
+		{"none below freezing", 20, 90, 0, 0, ""},
+		{"unusable humidity", 50, float32(math.NaN()), 0.1, 0, ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Reading{StationName: "test", RainRate: tc.rainRate, RainIncremental: tc.incremental}
+			if got := calcPrecipType(&r, tc.temp, tc.humidity, thresholds); got != tc.want {
+				t.Errorf("calcPrecipType(%v°F, %v%%) = %q, want %q", tc.temp, tc.humidity, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDerivedFieldsAtHumidityLimits(t *testing.T) {
+	for _, temp := range []float32{-40, 0, 32, 77, 95, 120} {
+		// At saturation, the dew point and wet-bulb temperature are the air temperature
+		r := Reading{StationName: "test", OutTemp: temp, OutHumidity: 100}
+		calcDerivedFields(&r, DerivedFieldsConfig{})
+		if math.Abs(float64(r.DewPoint-temp)) > 0.1 {
+			t.Errorf("dew point at %v°F and 100%% RH = %v, want %v", temp, r.DewPoint, temp)
+		}
+		if math.Abs(float64(r.WetBulb-temp)) > 1 {
+			t.Errorf("wet-bulb at %v°F and 100%% RH = %v, want about %v", temp, r.WetBulb, temp)
+		}
+
+		// The dew point is undefined in perfectly dry air, so it's calculated at 1% RH
+		r = Reading{StationName: "test", OutTemp: temp, OutHumidity: 0}
+		calcDerivedFields(&r, DerivedFieldsConfig{})
+		if !isFinite(r.DewPoint) || r.DewPoint >= temp {
+			t.Errorf("dew point at %v°F and 0%% RH = %v, want a finite value below %v", temp, r.DewPoint, temp)
+		}
+		if !isFinite(r.WetBulb) || r.WetBulb > temp {
+			t.Errorf("wet-bulb at %v°F and 0%% RH = %v, want a finite value no higher than %v", temp, r.WetBulb, temp)
+		}
+		if r.AbsoluteHumidity != 0 {
+			t.Errorf("absolute humidity at %v°F and 0%% RH = %v, want 0", temp, r.AbsoluteHumidity)
+		}
+		if !isFinite(r.HeatIndex) {
+			t.Errorf("heat index at %v°F and 0%% RH = %v, want a finite value", temp, r.HeatIndex)
+		}
+	}
+}
+
+func TestDerivedFieldsAreFinite(t *testing.T) {
+	inf := float32(math.Inf(1))
+	nan := float32(math.NaN())
+
+	tests := []struct {
+		name     string
+		temp     float32
+		humidity float32
+		wind     float32
+	}{
+		{"absolute zero", -459.67, 50, 10},
+		{"absolute zero and dry", -459.67, 0, 10},
+		// 243.04° C below zero, where the Magnus formula divides by zero
+		{"Magnus singularity", -405.472, 50, 0},
+		{"extreme heat", 1e6, 50, 0},
+		{"extreme heat and saturated", 1e6, 100, 0},
+		{"extreme cold and wind", -1e6, 50, 1e6},
+		{"negative humidity", 90, -50, 0},
+		{"humidity above 100%", 90, 1e6, 0},
+		{"infinite temperature", inf, 50, 10},
+		{"negative infinite temperature", -inf, 50, 10},
+		{"NaN temperature", nan, 50, 10},
+		{"NaN humidity", 90, nan, 10},
+		{"infinite humidity", 90, inf, 10},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := Reading{StationName: "test", OutTemp: tc.temp, OutHumidity: tc.humidity, WindSpeed: tc.wind,
+				RainRate: 0.1}
+			calcDerivedFields(&r, DerivedFieldsConfig{})
+
+			for field, v := range map[string]float32{
+				"wind chill":           r.WindChill,
+				"heat index":           r.HeatIndex,
+				"dew point":            r.DewPoint,
+				"wet-bulb temperature": r.WetBulb,
+				"absolute humidity":    r.AbsoluteHumidity,
+			} {
+				if !isFinite(v) {
+					t.Errorf("%v at %v°F and %v%% RH = %v, want a finite value", field, tc.temp, tc.humidity, v)
+				}
+			}
+
+			// An unusable wet-bulb temperature leaves precipitation unclassified
+			// instead of guessing
+			thresholds := PrecipTypeThresholds{SnowMaxWetBulb: defaultSnowMaxWetBulb, RainMinWetBulb: defaultRainMinWetBulb}
+			if !isFinite(calcWetBulb(tc.temp, tc.humidity)) {
+				if got := calcPrecipType(&r, tc.temp, tc.humidity, thresholds); got != "" {
+					t.Errorf("precip type with a non-finite wet-bulb = %q, want none", got)
+				}
+			}
+		})
+	}
+}
+
+func TestFiniteDerivedValueFallback(t *testing.T) {
+	r := Reading{StationName: "test"}
+	nan := float32(math.NaN())
+
+	if got := finiteDerivedValue(&r, "heat index", 101.5, 90, 90, 50); got != 101.5 {
+		t.Errorf("finite value was replaced with %v", got)
+	}
+	if got := finiteDerivedValue(&r, "heat index", nan, 90, 90, 50); got != 90 {
+		t.Errorf("NaN was replaced with %v, want the fallback 90", got)
+	}
+	if got := finiteDerivedValue(&r, "heat index", float32(math.Inf(-1)), nan, nan, 50); got != 0 {
+		t.Errorf("-Inf with a NaN fallback was replaced with %v, want 0", got)
+	}
+}